@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	_ "time/tzdata" // user time zones must resolve on hosts without a zoneinfo database
 
+	"github.com/assaidy/todo-api/mailer"
 	"github.com/assaidy/todo-api/repo"
 	"github.com/assaidy/todo-api/router"
+	"github.com/assaidy/todo-api/scheduler"
 	"github.com/assaidy/todo-api/config"
+	"github.com/assaidy/todo-api/utils"
 )
 
 func main() {
@@ -19,14 +24,40 @@ func main() {
 		config.DBName,
 	)
 
+	if err := utils.LoadJWTKeys(); err != nil {
+		log.Fatalf("Failed to load jwt keys: %v", err)
+	}
+
+	if err := utils.CheckPasswordHashParams(); err != nil {
+		log.Fatalf("Invalid password hash config: %v", err)
+	}
+
+	if err := utils.CheckCursorSecret(); err != nil {
+		log.Fatalf("Invalid cursor config: %v", err)
+	}
+
 	repo, err := repo.New(dbConn)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer repo.DB.Close()
 
-	router := router.NewRouter(repo)
+	mailer, err := mailer.New()
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+
+	// every replica runs a scheduler, they share the work through the database
+	if config.SchedulerEnabled {
+		notifier, err := scheduler.NewNotifier(mailer)
+		if err != nil {
+			log.Fatalf("Failed to set up reminder notifier: %v", err)
+		}
+		go scheduler.New(repo, notifier).Run(context.Background())
+	}
+
+	router := router.NewRouter(repo, mailer)
 
-	log.Println("Running server on port %s", config.Port)
+	log.Printf("Running server on port %s", config.Port)
 	log.Fatal(http.ListenAndServe(config.Port, router))
 }
@@ -15,14 +15,93 @@ func init() {
 }
 
 var (
-	Port               = ":" + getEnv("PORT", "8080")
-	DBHost             = getEnv("DB_HOST", "localhost")
-	DBPort             = getEnvAsInt("DB_PORT", 5432)
-	DBUser             = getEnv("DB_USER", "postgres")
-	DBPassword         = getEnv("DB_PASSWORD", "postgres")
-	DBName             = getEnv("DB_NAME", "todo_api")
-	JWTSecret          = getEnv("JWT_SECRET", "mysecret")
-	JWTExpirationHours = getEnvAsInt("JWT_EXPIRATION_HOURS", 72)
+	Port       = ":" + getEnv("PORT", "8080")
+	DBHost     = getEnv("DB_HOST", "localhost")
+	DBPort     = getEnvAsInt("DB_PORT", 5432)
+	DBUser     = getEnv("DB_USER", "postgres")
+	DBPassword = getEnv("DB_PASSWORD", "postgres")
+	DBName     = getEnv("DB_NAME", "todo_api")
+
+	JWTSecret            = getEnv("JWT_SECRET", "mysecret")
+	JWTExpirationMinutes = getEnvAsInt("JWT_EXPIRATION_MINUTES", 15)
+	// HS256 signs with JWTSecret, RS256 and EdDSA sign with the private key
+	// JWTKeysDir/<JWTSigningKeyId>.pem, every other key in JWTKeysDir is
+	// still accepted for verification and published in the JWKS.
+	JWTSigningMethod = getEnv("JWT_SIGNING_METHOD", "HS256")
+	JWTKeysDir       = getEnv("JWT_KEYS_DIR", "keys")
+	JWTSigningKeyId  = getEnv("JWT_SIGNING_KEY_ID", "")
+
+	RefreshTokenExpirationHours = getEnvAsInt("REFRESH_TOKEN_EXPIRATION_HOURS", 30*24)
+	// how long a replica trusts its cached "not revoked" answers
+	RevocationCacheSeconds = getEnvAsInt("REVOCATION_CACHE_SECONDS", 30)
+
+	// failed logins before an account or ip gets locked out, every further
+	// failure doubles the lockout starting from LoginLockoutSeconds
+	LoginMaxAttemptsPerAccount = getEnvAsInt("LOGIN_MAX_ATTEMPTS_PER_ACCOUNT", 5)
+	LoginMaxAttemptsPerIP      = getEnvAsInt("LOGIN_MAX_ATTEMPTS_PER_IP", 20)
+	LoginLockoutSeconds        = getEnvAsInt("LOGIN_LOCKOUT_SECONDS", 60)
+	LoginMaxLockoutMinutes     = getEnvAsInt("LOGIN_MAX_LOCKOUT_MINUTES", 60)
+	LoginAttemptWindowMinutes  = getEnvAsInt("LOGIN_ATTEMPT_WINDOW_MINUTES", 15)
+
+	// only trust X-Forwarded-For when running behind a reverse proxy
+	TrustProxyHeaders = getEnvAsBool("TRUST_PROXY_HEADERS", false)
+
+	// the reset token is appended to PasswordResetURL, point it to a page of
+	// your frontend that posts the new password to /password/reset
+	PasswordResetURL               = getEnv("PASSWORD_RESET_URL", "http://localhost:8080/password/reset?token=")
+	PasswordResetExpirationMinutes = getEnvAsInt("PASSWORD_RESET_EXPIRATION_MINUTES", 30)
+
+	// the verification token is appended to EmailVerificationURL
+	EmailVerificationURL             = getEnv("EMAIL_VERIFICATION_URL", "http://localhost:8080/verify-email?token=")
+	EmailVerificationExpirationHours = getEnvAsInt("EMAIL_VERIFICATION_EXPIRATION_HOURS", 48)
+	EmailVerificationResendSeconds   = getEnvAsInt("EMAIL_VERIFICATION_RESEND_SECONDS", 60)
+	EmailVerificationMaxPerHour      = getEnvAsInt("EMAIL_VERIFICATION_MAX_PER_HOUR", 5)
+	// unverified accounts can still read their todos, but not change them
+	RequireVerifiedEmail = getEnvAsBool("REQUIRE_VERIFIED_EMAIL", false)
+
+	// secrets of authenticator apps are stored encrypted with this key
+	TOTPEncryptionKey         = getEnv("TOTP_ENCRYPTION_KEY", "mytotpsecret")
+	TOTPIssuer                = getEnv("TOTP_ISSUER", "todo-api")
+	TwoFactorChallengeMinutes = getEnvAsInt("TWO_FACTOR_CHALLENGE_MINUTES", 5)
+
+	// log, file or smtp
+	MailDriver   = getEnv("MAIL_DRIVER", "log")
+	MailFrom     = getEnv("MAIL_FROM", "todo-api@localhost")
+	MailFilePath = getEnv("MAIL_FILE_PATH", "mail.log")
+	SMTPHost     = getEnv("SMTP_HOST", "localhost")
+	SMTPPort     = getEnvAsInt("SMTP_PORT", 587)
+	SMTPUsername = getEnv("SMTP_USERNAME", "")
+	SMTPPassword = getEnv("SMTP_PASSWORD", "")
+
+	PasswordHashMemoryKiB   = getEnvAsInt("PASSWORD_HASH_MEMORY_KIB", 64*1024)
+	PasswordHashIterations  = getEnvAsInt("PASSWORD_HASH_ITERATIONS", 3)
+	PasswordHashParallelism = getEnvAsInt("PASSWORD_HASH_PARALLELISM", 2)
+	// key used to decrypt passwords stored before hashing was introduced,
+	// they get rehashed on the user's next login.
+	PasswordLegacyKey = getEnv("PASSWORD_LEGACY_KEY", JWTSecret)
+
+	SchedulerEnabled      = getEnvAsBool("SCHEDULER_ENABLED", true)
+	ReminderNotifier      = getEnv("REMINDER_NOTIFIER", "log")
+	ReminderWebhookURL    = getEnv("REMINDER_WEBHOOK_URL", "")
+	ReminderWebhookSecret = getEnv("REMINDER_WEBHOOK_SECRET", "")
+	ReminderPollSeconds   = getEnvAsInt("REMINDER_POLL_SECONDS", 15)
+	ReminderBatchSize     = getEnvAsInt("REMINDER_BATCH_SIZE", 50)
+	ReminderMaxAttempts   = getEnvAsInt("REMINDER_MAX_ATTEMPTS", 5)
+	// the n-th retry waits base * 2^(n-1)
+	ReminderRetryBaseSeconds = getEnvAsInt("REMINDER_RETRY_BASE_SECONDS", 30)
+	// how long a replica may take to deliver the reminders it claimed before
+	// another one picks them up again
+	ReminderLeaseSeconds = getEnvAsInt("REMINDER_LEASE_SECONDS", 60)
+	// reminders that are older than this when first seen are skipped
+	ReminderMaxDelayHours = getEnvAsInt("REMINDER_MAX_DELAY_HOURS", 24)
+
+	// how many levels subtasks can be nested below a top level todo
+	TodoMaxDepth = getEnvAsInt("TODO_MAX_DEPTH", 3)
+	// the largest page a list can be asked for with ?limit=
+	MaxPageLimit = getEnvAsInt("MAX_PAGE_LIMIT", 100)
+	// signs the pagination cursors of todo lists. With HS256 it may be left
+	// empty, a key is derived from JWTSecret then.
+	CursorSecret = getEnv("CURSOR_SECRET", "")
 )
 
 // getEnv retrieves the value of the environment variable named by the key.
@@ -34,6 +113,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvAsBool retrieves the value of the environment variable named by the key as a boolean.
+// If the variable is not present or cannot be converted to a boolean, it returns the defaultValue.
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		if value, err := strconv.ParseBool(valueStr); err == nil {
+			return value
+		}
+	}
+	return defaultValue
+}
+
 // getEnvAsInt retrieves the value of the environment variable named by the key as an integer.
 // If the variable is not present or cannot be converted to an integer, it returns the defaultValue.
 func getEnvAsInt(key string, defaultValue int) int {
@@ -0,0 +1,70 @@
+// Package filter parses the filter expressions todo lists can be narrowed
+// down with, e.g.
+//
+//	status in (todo, doing) and created_at > 2026-01-01 and title ~ "report"
+//
+// into an Expr. What the fields mean is up to whoever compiles it.
+package filter
+
+// Expr is a node of a parsed filter expression: And, Or, Not or Comparison.
+type Expr interface {
+	expr()
+}
+
+type And struct {
+	Left, Right Expr
+}
+
+type Or struct {
+	Left, Right Expr
+}
+
+type Not struct {
+	Expr Expr
+}
+
+// Comparison operators.
+const (
+	OpEq        = "="
+	OpNe        = "!="
+	OpLt        = "<"
+	OpLe        = "<="
+	OpGt        = ">"
+	OpGe        = ">="
+	OpMatch     = "~"  // contains, ignoring case
+	OpNotMatch  = "!~" // doesn't contain, ignoring case
+	OpIn        = "in"
+	OpNotIn     = "not in"
+	OpIsNull    = "is null"
+	OpIsNotNull = "is not null"
+)
+
+// Comparison compares a field to its values: one for most operators, one
+// or more for OpIn and OpNotIn, none for OpIsNull and OpIsNotNull.
+type Comparison struct {
+	Field  string
+	Op     string
+	Values []string
+	// Pos is the offset of the field in the expression
+	Pos int
+}
+
+func (And) expr()        {}
+func (Or) expr()         {}
+func (Not) expr()        {}
+func (Comparison) expr() {}
+
+// AndAll joins the non-nil exprs with And, it returns nil if there are none.
+func AndAll(exprs ...Expr) Expr {
+	var joined Expr
+	for _, e := range exprs {
+		switch {
+		case e == nil:
+		case joined == nil:
+			joined = e
+		default:
+			joined = And{Left: joined, Right: e}
+		}
+	}
+	return joined
+}
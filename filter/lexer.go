@@ -0,0 +1,132 @@
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of filter"
+	case tokenString:
+		return fmt.Sprintf("%q", t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// is reports whether t is the keyword kw, keywords ignore case.
+func (t token) is(kw string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, kw)
+}
+
+var twoCharOps = []string{OpNe, OpLe, OpGe, OpNotMatch}
+
+var keywords = []string{"and", "or", "not", "in", "is", "null"}
+
+func (t token) isKeyword() bool {
+	return slices.ContainsFunc(keywords, t.is)
+}
+
+// lex splits s into tokens. Words are field names and unquoted values like
+// numbers and dates, strings are quoted with " or ' and may escape the quote
+// or a backslash with a backslash.
+func lex(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case strings.ContainsRune("=!<>~", r):
+			op := s[i : i+1]
+			if i+1 < len(s) && slices.Contains(twoCharOps, s[i:i+2]) {
+				op = s[i : i+2]
+			}
+			if op == "!" {
+				return nil, &Error{Pos: i, Msg: "unexpected '!'"}
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		case r == '"' || r == '\'':
+			text, end, err := lexString(s, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = end
+		case isWordRune(r):
+			start := i
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if !isWordRune(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: s[start:i], pos: start})
+		default:
+			return nil, &Error{Pos: i, Msg: fmt.Sprintf("unexpected %q", r)}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
+
+// lexString reads the string starting with the quote at s[start], it
+// returns its unquoted text and the offset after the closing quote.
+func lexString(s string, start int) (string, int, error) {
+	quote := s[start]
+	text := strings.Builder{}
+
+	for i := start + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == quote:
+			return text.String(), i + 1, nil
+		case c == '\\' && i+1 < len(s) && (s[i+1] == quote || s[i+1] == '\\'):
+			text.WriteByte(s[i+1])
+			i++
+		default:
+			text.WriteByte(c)
+		}
+	}
+
+	return "", 0, &Error{Pos: start, Msg: "unterminated string"}
+}
+
+// words may contain what dates, timestamps and numbers are made of
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.:+", r)
+}
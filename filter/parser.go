@@ -0,0 +1,229 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	MaxLength      = 2000
+	MaxComparisons = 50
+	MaxDepth       = 20
+)
+
+// Error is a syntax error at the byte offset Pos of the expression.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("filter: %s at position %d", e.Msg, e.Pos)
+}
+
+// Parse parses a filter expression:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" expr ")" | comparison
+//	comparison = field op value
+//	           | field [ "not" ] "in" "(" value { "," value } ")"
+//	           | field "is" [ "not" ] "null"
+//	op         = "=" | "!=" | "<" | "<=" | ">" | ">=" | "~" | "!~"
+//
+// Keywords ignore case. Values are words like 2026-01-01 or 3, or quoted strings.
+func Parse(s string) (Expr, error) {
+	if len(s) > MaxLength {
+		return nil, &Error{Pos: MaxLength, Msg: fmt.Sprintf("filter is longer than %d characters", MaxLength)}
+	}
+
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t, "'and', 'or' or end of filter")
+	}
+
+	return expr, nil
+}
+
+type parser struct {
+	tokens      []token
+	pos         int
+	depth       int
+	comparisons int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token, expected string) error {
+	return &Error{Pos: t.pos, Msg: fmt.Sprintf("expected %s, got %s", expected, t)}
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > MaxDepth {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("filter is nested deeper than %d levels", MaxDepth)}
+	}
+
+	switch {
+	case t.is("not"):
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: expr}, nil
+
+	case t.kind == tokenLParen:
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, p.unexpected(t, "')'")
+		}
+		return expr, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	field := p.next()
+	if field.kind != tokenWord || field.isKeyword() {
+		return nil, p.unexpected(field, "a field")
+	}
+
+	p.comparisons++
+	if p.comparisons > MaxComparisons {
+		return nil, &Error{Pos: field.pos, Msg: fmt.Sprintf("filter has more than %d comparisons", MaxComparisons)}
+	}
+
+	c := Comparison{Field: strings.ToLower(field.text), Pos: field.pos}
+
+	switch t := p.next(); {
+	case t.kind == tokenOp:
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		c.Op = t.text
+		c.Values = []string{value}
+
+	case t.is("in"), t.is("not") && p.peek().is("in"):
+		c.Op = OpIn
+		if t.is("not") {
+			p.next()
+			c.Op = OpNotIn
+		}
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		c.Values = values
+
+	case t.is("is"):
+		c.Op = OpIsNull
+		if p.peek().is("not") {
+			p.next()
+			c.Op = OpIsNotNull
+		}
+		if t := p.next(); !t.is("null") {
+			return nil, p.unexpected(t, "'null'")
+		}
+
+	default:
+		return nil, p.unexpected(t, "an operator")
+	}
+
+	return c, nil
+}
+
+func (p *parser) parseList() ([]string, error) {
+	if t := p.next(); t.kind != tokenLParen {
+		return nil, p.unexpected(t, "'('")
+	}
+
+	var values []string
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		switch t := p.next(); t.kind {
+		case tokenComma:
+		case tokenRParen:
+			return values, nil
+		default:
+			return nil, p.unexpected(t, "',' or ')'")
+		}
+	}
+}
+
+func (p *parser) parseValue() (string, error) {
+	t := p.next()
+	if t.kind == tokenString || (t.kind == tokenWord && !t.isKeyword()) {
+		return t.text, nil
+	}
+	return "", p.unexpected(t, "a value")
+}
@@ -0,0 +1,249 @@
+package filter
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func cmp(field, op string, pos int, values ...string) Comparison {
+	return Comparison{Field: field, Op: op, Values: values, Pos: pos}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Expr
+	}{
+		{
+			name: "comparison",
+			in:   "priority <= 1",
+			want: cmp("priority", OpLe, 0, "1"),
+		},
+		{
+			name: "and binds tighter than or",
+			in:   "a = 1 or b = 2 and c = 3",
+			want: Or{
+				Left:  cmp("a", OpEq, 0, "1"),
+				Right: And{Left: cmp("b", OpEq, 9, "2"), Right: cmp("c", OpEq, 19, "3")},
+			},
+		},
+		{
+			name: "and and or are left associative",
+			in:   "a = 1 and b = 2 and c = 3",
+			want: And{
+				Left:  And{Left: cmp("a", OpEq, 0, "1"), Right: cmp("b", OpEq, 10, "2")},
+				Right: cmp("c", OpEq, 20, "3"),
+			},
+		},
+		{
+			name: "parentheses",
+			in:   "(a = 1 or b = 2) and c = 3",
+			want: And{
+				Left:  Or{Left: cmp("a", OpEq, 1, "1"), Right: cmp("b", OpEq, 10, "2")},
+				Right: cmp("c", OpEq, 21, "3"),
+			},
+		},
+		{
+			name: "not binds tighter than and",
+			in:   "not a = 1 and b = 2",
+			want: And{Left: Not{Expr: cmp("a", OpEq, 4, "1")}, Right: cmp("b", OpEq, 14, "2")},
+		},
+		{
+			name: "not of a group",
+			in:   "not (a = 1 or b = 2)",
+			want: Not{Expr: Or{Left: cmp("a", OpEq, 5, "1"), Right: cmp("b", OpEq, 14, "2")}},
+		},
+		{
+			name: "keywords and fields ignore case",
+			in:   "Status IN (todo, Doing) AND tag IS NOT NULL",
+			want: And{
+				Left:  cmp("status", OpIn, 0, "todo", "Doing"),
+				Right: cmp("tag", OpIsNotNull, 28),
+			},
+		},
+		{
+			name: "not in and is null",
+			in:   "status not in (done) or due_at is null",
+			want: Or{
+				Left:  cmp("status", OpNotIn, 0, "done"),
+				Right: cmp("due_at", OpIsNull, 24),
+			},
+		},
+		{
+			name: "two character operators",
+			in:   "a != 1 and b >= 2 and c !~ x",
+			want: And{
+				Left:  And{Left: cmp("a", OpNe, 0, "1"), Right: cmp("b", OpGe, 11, "2")},
+				Right: cmp("c", OpNotMatch, 22, "x"),
+			},
+		},
+		{
+			name: "operators need no spaces",
+			in:   "a<=1",
+			want: cmp("a", OpLe, 0, "1"),
+		},
+		{
+			name: "words hold dates, timestamps and relative dates",
+			in:   "due_at >= 2026-01-01T09:00:00+02:00 and due_at < today+7",
+			want: And{
+				Left:  cmp("due_at", OpGe, 0, "2026-01-01T09:00:00+02:00"),
+				Right: cmp("due_at", OpLt, 40, "today+7"),
+			},
+		},
+		{
+			name: "double quoted string",
+			in:   `title ~ "weekly report"`,
+			want: cmp("title", OpMatch, 0, "weekly report"),
+		},
+		{
+			name: "single quoted string",
+			in:   `title = 'say "hi"'`,
+			want: cmp("title", OpEq, 0, `say "hi"`),
+		},
+		{
+			name: "escaped quote",
+			in:   `title = "say \"hi\""`,
+			want: cmp("title", OpEq, 0, `say "hi"`),
+		},
+		{
+			name: "escaped single quote",
+			in:   `title = 'it\'s'`,
+			want: cmp("title", OpEq, 0, "it's"),
+		},
+		{
+			name: "escaped backslash",
+			in:   `title = "a\\b"`,
+			want: cmp("title", OpEq, 0, `a\b`),
+		},
+		{
+			name: "other backslashes are kept",
+			in:   `title = "a\nb"`,
+			want: cmp("title", OpEq, 0, `a\nb`),
+		},
+		{
+			name: "keywords may be quoted values",
+			in:   `tag = "null"`,
+			want: cmp("tag", OpEq, 0, "null"),
+		},
+		{
+			name: "empty string",
+			in:   `description = ""`,
+			want: cmp("description", OpEq, 0, ""),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q)\n got %#v\nwant %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		pos  int
+		msg  string
+	}{
+		{name: "empty", in: "", pos: 0, msg: "expected a field, got end of filter"},
+		{name: "missing value", in: "a =", pos: 3, msg: "expected a value"},
+		{name: "missing operator", in: "a 1", pos: 2, msg: "expected an operator"},
+		{name: "missing and", in: "a = 1 b = 2", pos: 6, msg: "expected 'and', 'or' or end of filter"},
+		{name: "keyword as field", in: "and = 1", pos: 0, msg: "expected a field"},
+		{name: "keyword as value", in: "a = or", pos: 4, msg: "expected a value"},
+		{name: "unclosed parenthesis", in: "(a = 1", pos: 6, msg: "expected ')'"},
+		{name: "stray parenthesis", in: "a = 1)", pos: 5, msg: "expected 'and', 'or' or end of filter"},
+		{name: "in without list", in: "a in x", pos: 5, msg: "expected '('"},
+		{name: "empty list", in: "a in ()", pos: 6, msg: "expected a value"},
+		{name: "unclosed list", in: "a in (x, y", pos: 10, msg: "expected ',' or ')'"},
+		{name: "is without null", in: "a is 1", pos: 5, msg: "expected 'null'"},
+		{name: "lone bang", in: "a ! 1", pos: 2, msg: "unexpected '!'"},
+		{name: "unknown character", in: "a = $1", pos: 4, msg: "unexpected '$'"},
+		{name: "unterminated string", in: `a = "abc`, pos: 4, msg: "unterminated string"},
+		{name: "escaped closing quote", in: `a = "abc\"`, pos: 4, msg: "unterminated string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.in)
+			var ferr *Error
+			if !errors.As(err, &ferr) {
+				t.Fatalf("Parse(%q) = %v, want an *Error", tt.in, err)
+			}
+			if ferr.Pos != tt.pos || !strings.Contains(ferr.Msg, tt.msg) {
+				t.Errorf("Parse(%q) = %q at %d, want %q at %d", tt.in, ferr.Msg, ferr.Pos, tt.msg, tt.pos)
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	comparisons := func(n int) string {
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = "a = 1"
+		}
+		return strings.Join(parts, " and ")
+	}
+	nested := func(n int) string {
+		return strings.Repeat("(", n) + "a = 1" + strings.Repeat(")", n)
+	}
+	negated := func(n int) string {
+		return strings.Repeat("not ", n) + "a = 1"
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		msg  string // empty if it parses
+	}{
+		{name: "longest filter", in: `a = "` + strings.Repeat("x", MaxLength-6) + `"`},
+		{name: "too long", in: `a = "` + strings.Repeat("x", MaxLength-5) + `"`, msg: "longer than"},
+		{name: "most comparisons", in: comparisons(MaxComparisons)},
+		{name: "too many comparisons", in: comparisons(MaxComparisons + 1), msg: "more than"},
+		// the comparison itself is one level
+		{name: "deepest parentheses", in: nested(MaxDepth - 1)},
+		{name: "parentheses too deep", in: nested(MaxDepth), msg: "nested deeper than"},
+		{name: "deepest not", in: negated(MaxDepth - 1)},
+		{name: "not too deep", in: negated(MaxDepth), msg: "nested deeper than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.in)
+			if tt.msg == "" {
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Fatalf("Parse = %v, want an error containing %q", err, tt.msg)
+			}
+		})
+	}
+}
+
+func TestAndAll(t *testing.T) {
+	a, b := cmp("a", OpEq, 0, "1"), cmp("b", OpEq, 0, "2")
+
+	if got := AndAll(nil, nil); got != nil {
+		t.Errorf("AndAll(nil, nil) = %#v, want nil", got)
+	}
+	if got := AndAll(nil, a); !reflect.DeepEqual(got, a) {
+		t.Errorf("AndAll(nil, a) = %#v, want a", got)
+	}
+	if got, want := AndAll(a, nil, b), (And{Left: a, Right: b}); !reflect.DeepEqual(got, want) {
+		t.Errorf("AndAll(a, nil, b) = %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/assaidy/todo-api/config"
+	"github.com/assaidy/todo-api/mailer"
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/repo"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+type AuthHandler struct {
+	repo   *repo.Repo
+	mailer mailer.Mailer
+}
+
+func NewAuthHandler(r *repo.Repo, m mailer.Mailer) *AuthHandler {
+	return &AuthHandler{
+		repo:   r,
+		mailer: m,
+	}
+}
+
+func (h *AuthHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) error {
+	req := models.TokenRefreshRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	refreshToken, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	next := models.RefreshToken{
+		TokenHash: hash,
+		ExpiresAt: refreshTokenExpiration(),
+	}
+	if err := h.repo.RotateRefreshToken(utils.HashOpaqueToken(req.RefreshToken), &next); err != nil {
+		return err
+	}
+
+	token, err := utils.CreateToken(next.UserId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, &models.TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    config.JWTExpirationMinutes * 60,
+	})
+}
+
+func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	token, ok := utils.GetTokenInfoFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	// the body is optional
+	req := models.LogoutRequest{}
+	if r.ContentLength != 0 {
+		if err := utils.ParseJSON(r, &req); err != nil {
+			return err
+		}
+	}
+
+	if req.All {
+		if err := revokeAllSessions(h.repo, userId); err != nil {
+			return err
+		}
+		return utils.WriteJSON(w, http.StatusNoContent, nil)
+	}
+
+	if token.Id != "" {
+		if err := h.repo.RevokeToken(token.Id, userId, token.ExpiresAt); err != nil {
+			return err
+		}
+	} else {
+		// legacy token without a jti, it can only be revoked with the rest
+		if err := h.repo.RevokeAllTokensByUserId(userId); err != nil {
+			return err
+		}
+	}
+
+	if req.RefreshToken != "" {
+		if err := h.repo.RevokeRefreshTokenFamilyByHash(userId, utils.HashOpaqueToken(req.RefreshToken)); err != nil {
+			return err
+		}
+	}
+
+	return utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *AuthHandler) HandleGetJWKS(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return utils.WriteJSON(w, http.StatusOK, utils.JWKS())
+}
+
+func (h *AuthHandler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) error {
+	req := models.PasswordForgotRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	// always answer the same way so this can't be used to find accounts
+	accepted := map[string]any{
+		"msg": "if an account with that email exists, a reset link has been sent to it",
+	}
+
+	user, err := h.repo.GetUserByEmail(req.Email)
+	if err != nil {
+		if utils.IsApiError(err, http.StatusNotFound) {
+			return utils.WriteJSON(w, http.StatusAccepted, accepted)
+		}
+		return err
+	}
+
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Minute * time.Duration(config.PasswordResetExpirationMinutes))
+	if err := h.repo.InsertPasswordReset(user.Id, hash, expiresAt); err != nil {
+		return err
+	}
+
+	// sent in the background, so response times don't tell either
+	go func() {
+		err := h.mailer.Send(context.Background(), mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes.\n\n%s%s\n\nIf you didn't ask for this, you can ignore this email.",
+				user.Name, config.PasswordResetExpirationMinutes, config.PasswordResetURL, token),
+		})
+		if err != nil {
+			slog.Error("Failed to send password reset email", "err", err.Error(), "userId", user.Id)
+		}
+	}()
+
+	return utils.WriteJSON(w, http.StatusAccepted, accepted)
+}
+
+func (h *AuthHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) error {
+	req := models.PasswordResetRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+
+	userId, err := h.repo.ResetPassword(utils.HashOpaqueToken(req.Token), hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := revokeAllSessions(h.repo, userId); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *AuthHandler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return utils.InvalidRequestData("missing token")
+	}
+
+	if err := h.repo.VerifyEmail(utils.HashOpaqueToken(token)); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"msg": "email address verified",
+	})
+}
+
+func (h *AuthHandler) HandleResendVerificationEmail(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	user, err := h.repo.GetUserById(userId)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return utils.InvalidRequestData("email address is already verified")
+	}
+
+	sinceLast, sentLastHour, err := h.repo.GetEmailVerificationResendStats(userId)
+	if err != nil {
+		return err
+	}
+
+	interval := time.Second * time.Duration(config.EmailVerificationResendSeconds)
+	if sinceLast != nil && *sinceLast < interval {
+		w.Header().Set("Retry-After", strconv.Itoa(int((interval - *sinceLast).Seconds())))
+		return utils.TooManyRequestsError("a verification email was sent recently, try again later")
+	}
+	if sentLastHour >= config.EmailVerificationMaxPerHour {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Hour.Seconds())))
+		return utils.TooManyRequestsError("too many verification emails, try again later")
+	}
+
+	if err := sendVerificationEmail(h.repo, h.mailer, user); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusAccepted, map[string]any{
+		"msg": fmt.Sprintf("a verification link has been sent to '%s'", user.Email),
+	})
+}
+
+// sendVerificationEmail mails the user a link that verifies their current email address.
+func sendVerificationEmail(r *repo.Repo, m mailer.Mailer, user *models.User) error {
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Hour * time.Duration(config.EmailVerificationExpirationHours))
+	if err := r.InsertEmailVerification(user.Id, user.Email, hash, expiresAt); err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %d hours.\n\n%s%s",
+			user.Name, config.EmailVerificationExpirationHours, config.EmailVerificationURL, token),
+	}
+	go func() {
+		if err := m.Send(context.Background(), msg); err != nil {
+			slog.Error("Failed to send verification email", "err", err.Error(), "userId", user.Id)
+		}
+	}()
+
+	return nil
+}
+
+// revokeAllSessions invalidates every access and refresh token of the user.
+func revokeAllSessions(r *repo.Repo, userId int) error {
+	if err := r.RevokeAllTokensByUserId(userId); err != nil {
+		return err
+	}
+	return r.RevokeAllRefreshTokensByUserId(userId)
+}
+
+// writeSession responds with the tokens of a freshly started session.
+func writeSession(w http.ResponseWriter, status int, tokens *models.TokenPair, user *models.User) error {
+	return utils.WriteJSON(w, status, map[string]any{
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"user":         user,
+	})
+}
+
+// issueTokens creates an access token for the user and starts a new refresh token family.
+func issueTokens(r *repo.Repo, userId int) (*models.TokenPair, error) {
+	token, err := utils.CreateToken(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	familyId, err := utils.RandomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.InsertRefreshToken(&models.RefreshToken{
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: hash,
+		ExpiresAt: refreshTokenExpiration(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    config.JWTExpirationMinutes * 60,
+	}, nil
+}
+
+// loginAttemptKeys returns the keys failed logins are tracked under, one for
+// the client and one for the account, whether the account exists or not.
+func loginAttemptKeys(r *http.Request, email string) (ipKey, accountKey string) {
+	return "ip:" + utils.ClientIP(r), "account:" + strings.ToLower(email)
+}
+
+// loginLimit is a key login attempts are counted under, see loginAttemptKeys,
+// and how many of them it gets within config.LoginAttemptWindowMinutes.
+type loginLimit struct {
+	key         string
+	maxAttempts int
+}
+
+// beginLoginAttempt counts an attempt for every limit before the credentials
+// are checked, so a burst of parallel guesses can't all get in before their
+// failures are recorded. Attempts count as failures unless the caller takes
+// them back on success. The attempt using up a key's last try locks it out,
+// and the lockout doubles with every attempt after it up to
+// config.LoginMaxLockoutMinutes. While any key is locked out it fails with
+// 429 and sets Retry-After.
+func beginLoginAttempt(w http.ResponseWriter, r *repo.Repo, limits ...loginLimit) error {
+	window := time.Minute * time.Duration(config.LoginAttemptWindowMinutes)
+	lockout := time.Second * time.Duration(config.LoginLockoutSeconds)
+	maxLockout := time.Minute * time.Duration(config.LoginMaxLockoutMinutes)
+
+	for i, limit := range limits {
+		ok, err := r.RecordLoginAttempt(limit.key, window, limit.maxAttempts, lockout, maxLockout)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+
+		// a refused attempt doesn't count anywhere
+		keys := make([]string, len(limits))
+		for j, counted := range limits {
+			keys[j] = counted.key
+			if j < i {
+				if err := r.RefundLoginAttempt(counted.key, counted.maxAttempts); err != nil {
+					return err
+				}
+			}
+		}
+
+		retryAfter, err := r.GetLoginRetryAfter(keys...)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(retryAfter.Seconds()), 1)))
+		return utils.TooManyRequestsError("too many failed attempts, try again later")
+	}
+
+	return nil
+}
+
+func refreshTokenExpiration() time.Time {
+	return time.Now().UTC().Add(time.Hour * time.Duration(config.RefreshTokenExpirationHours))
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/repo"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type ProjectHandler struct {
+	repo *repo.Repo
+}
+
+func NewProjectHandler(r *repo.Repo) *ProjectHandler {
+	return &ProjectHandler{
+		repo: r,
+	}
+}
+
+func (h *ProjectHandler) HandleGetAllProjectsByUser(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	projects, err := h.repo.GetProjectsByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"data": projects,
+	})
+}
+
+func (h *ProjectHandler) HandleCreateProject(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	req := models.ProjectCreateOrUpdateRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	projects, err := h.repo.GetProjectsByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	if exists, err := h.repo.CheckProjectNameExists(userId, req.Name); err != nil {
+		return err
+	} else if exists {
+		return utils.AlreadyExistsError(fmt.Sprintf("project '%s' already exists", req.Name))
+	}
+
+	project := models.Project{
+		UserId:   userId,
+		Name:     req.Name,
+		Color:    req.Color,
+		Archived: req.Archived,
+		Position: len(projects),
+	}
+	if req.Position != nil {
+		project.Position = *req.Position
+	}
+
+	if err := h.repo.InsertProject(&project); err != nil {
+		return err
+	}
+
+	return h.writeProject(w, http.StatusCreated, project.Id, userId)
+}
+
+func (h *ProjectHandler) HandleUpdateProjectById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	projectId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	req := models.ProjectCreateOrUpdateRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	project, err := h.repo.GetProjectByIdAndUserId(projectId, userId)
+	if err != nil {
+		return err
+	}
+
+	if req.Name != project.Name {
+		if exists, err := h.repo.CheckProjectNameExists(userId, req.Name); err != nil {
+			return err
+		} else if exists {
+			return utils.AlreadyExistsError(fmt.Sprintf("project '%s' already exists", req.Name))
+		}
+	}
+
+	project.Name = req.Name
+	project.Color = req.Color
+	project.Archived = req.Archived
+	if req.Position != nil {
+		project.Position = *req.Position
+	}
+
+	if err := h.repo.UpdateProject(project); err != nil {
+		return err
+	}
+
+	return h.writeProject(w, http.StatusOK, projectId, userId)
+}
+
+// HandleDeleteProjectById deletes a project. Its todos are moved to the
+// inbox, or deleted with it if ?todos=delete.
+func (h *ProjectHandler) HandleDeleteProjectById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	projectId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	deleteTodos := false
+	switch r.URL.Query().Get("todos") {
+	case "", "move":
+	case "delete":
+		deleteTodos = true
+	default:
+		return utils.InvalidRequestData("todos must be move or delete")
+	}
+
+	if err := h.repo.DeleteProject(projectId, userId, deleteTodos); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// writeProject writes the project as stored, its position may have been
+// clamped to the number of projects.
+func (h *ProjectHandler) writeProject(w http.ResponseWriter, code int, projectId, userId int) error {
+	project, err := h.repo.GetProjectByIdAndUserId(projectId, userId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, code, project)
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/repo"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type StatusHandler struct {
+	repo *repo.Repo
+}
+
+func NewStatusHandler(r *repo.Repo) *StatusHandler {
+	return &StatusHandler{
+		repo: r,
+	}
+}
+
+func (h *StatusHandler) HandleGetAllStatusesByUser(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	statuses, err := h.repo.GetStatusesByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"data": statuses,
+	})
+}
+
+func (h *StatusHandler) HandleCreateStatus(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	req := models.StatusCreateOrUpdateRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	wf, err := loadWorkflow(h.repo, userId)
+	if err != nil {
+		return err
+	}
+
+	if wf.status(req.Name) != nil {
+		return utils.AlreadyExistsError(fmt.Sprintf("status '%s' already exists", req.Name))
+	}
+	if err := wf.checkTransitionTargets(req.AllowedTransitions, ""); err != nil {
+		return err
+	}
+
+	status := models.Status{
+		UserId:             userId,
+		Name:               req.Name,
+		Color:              req.Color,
+		Position:           len(wf),
+		Terminal:           req.Terminal,
+		AllowedTransitions: req.AllowedTransitions,
+	}
+	if req.Position != nil {
+		status.Position = *req.Position
+	}
+
+	if err := h.repo.InsertStatus(&status); err != nil {
+		return err
+	}
+
+	return h.writeStatus(w, http.StatusCreated, userId, status.Id)
+}
+
+func (h *StatusHandler) HandleUpdateStatusById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	statusId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	req := models.StatusCreateOrUpdateRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	wf, err := loadWorkflow(h.repo, userId)
+	if err != nil {
+		return err
+	}
+
+	current := wf.statusById(statusId)
+	if current == nil {
+		return utils.NotFoundError(fmt.Sprintf("no status with id %d found", statusId))
+	}
+
+	if req.Name != current.Name && wf.status(req.Name) != nil {
+		return utils.AlreadyExistsError(fmt.Sprintf("status '%s' already exists", req.Name))
+	}
+	if err := wf.checkTransitionTargets(req.AllowedTransitions, current.Name); err != nil {
+		return err
+	}
+
+	status := models.Status{
+		Id:                 statusId,
+		UserId:             userId,
+		Name:               req.Name,
+		Color:              req.Color,
+		Position:           current.Position,
+		Terminal:           req.Terminal,
+		AllowedTransitions: renameTransitions(req.AllowedTransitions, current.Name, req.Name),
+	}
+	if req.Position != nil {
+		status.Position = *req.Position
+	}
+
+	if err := h.repo.UpdateStatus(&status); err != nil {
+		return err
+	}
+
+	return h.writeStatus(w, http.StatusOK, userId, statusId)
+}
+
+// HandleDeleteStatusById deletes a status that no todo uses, or moves its
+// todos to the status named in ?replacement= first.
+func (h *StatusHandler) HandleDeleteStatusById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	statusId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	wf, err := loadWorkflow(h.repo, userId)
+	if err != nil {
+		return err
+	}
+
+	status := wf.statusById(statusId)
+	if status == nil {
+		return utils.NotFoundError(fmt.Sprintf("no status with id %d found", statusId))
+	}
+	if len(wf) == 1 {
+		return utils.ConflictError("the last status can't be deleted")
+	}
+
+	replacement := r.URL.Query().Get("replacement")
+	if replacement != "" && (replacement == status.Name || wf.status(replacement) == nil) {
+		return utils.InvalidRequestData(fmt.Sprintf("replacement must be another existing status, got '%s'", replacement))
+	}
+
+	if err := h.repo.DeleteStatus(status, replacement); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *StatusHandler) writeStatus(w http.ResponseWriter, code int, userId, statusId int) error {
+	wf, err := loadWorkflow(h.repo, userId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, code, wf.statusById(statusId))
+}
+
+// workflow holds a user's statuses in order. It decides which statuses
+// todos can be in and move between.
+type workflow []*models.Status
+
+func loadWorkflow(r *repo.Repo, uid int) (workflow, error) {
+	statuses, err := r.GetStatusesByUserId(uid)
+	if err != nil {
+		return nil, err
+	}
+	return workflow(statuses), nil
+}
+
+func (wf workflow) status(name string) *models.Status {
+	for _, s := range wf {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (wf workflow) statusById(id int) *models.Status {
+	for _, s := range wf {
+		if s.Id == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// checkTransition returns an error if a todo can't move from one status to
+// another. from is empty for new todos, which may start in any status.
+func (wf workflow) checkTransition(from, to string) error {
+	target := wf.status(to)
+	if target == nil {
+		return utils.InvalidRequestData(fmt.Sprintf("unknown status '%s'", to))
+	}
+
+	if from == "" || from == to {
+		return nil
+	}
+
+	source := wf.status(from)
+	if source == nil || source.AllowedTransitions == nil {
+		return nil
+	}
+
+	if !slices.Contains(source.AllowedTransitions, to) {
+		return utils.ConflictError(fmt.Sprintf("todos can't move from status '%s' to '%s'", from, to))
+	}
+
+	return nil
+}
+
+func (wf workflow) isTerminal(name string) bool {
+	s := wf.status(name)
+	return s != nil && s.Terminal
+}
+
+// initial is the status new occurrences of recurring todos start in: the
+// first status that isn't terminal.
+func (wf workflow) initial() string {
+	for _, s := range wf {
+		if !s.Terminal {
+			return s.Name
+		}
+	}
+	if len(wf) > 0 {
+		return wf[0].Name
+	}
+	return ""
+}
+
+// completion is the status a todo in status from is finished with: the
+// first terminal status it can move to, or empty if there's none.
+func (wf workflow) completion(from string) string {
+	for _, s := range wf {
+		if s.Terminal && wf.checkTransition(from, s.Name) == nil {
+			return s.Name
+		}
+	}
+	return ""
+}
+
+// checkTransitionTargets checks that names only lists existing statuses,
+// self is the name of the status they're for.
+func (wf workflow) checkTransitionTargets(names []string, self string) error {
+	for _, name := range names {
+		if name != self && wf.status(name) == nil {
+			return utils.InvalidRequestData(fmt.Sprintf("unknown status '%s' in allowedTransitions", name))
+		}
+	}
+	return nil
+}
+
+// renameTransitions follows a rename in the transitions a status allows to itself.
+func renameTransitions(names []string, from, to string) []string {
+	if names == nil {
+		return nil
+	}
+	renamed := make([]string, len(names))
+	for i, name := range names {
+		renamed[i] = name
+		if name == from {
+			renamed[i] = to
+		}
+	}
+	return renamed
+}
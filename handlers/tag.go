@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/repo"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type TagHandler struct {
+	repo *repo.Repo
+}
+
+func NewTagHandler(r *repo.Repo) *TagHandler {
+	return &TagHandler{
+		repo: r,
+	}
+}
+
+func (h *TagHandler) HandleGetAllTagsByUser(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	tags, err := h.repo.GetTagsByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"data": tags,
+	})
+}
+
+func (h *TagHandler) HandleCreateTag(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	req := models.TagCreateOrUpdateRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	if exists, err := h.repo.CheckTagNameExists(userId, req.Name); err != nil {
+		return err
+	} else if exists {
+		return utils.AlreadyExistsError(fmt.Sprintf("tag '%s' already exists", req.Name))
+	}
+
+	tag := models.Tag{
+		UserId:    userId,
+		Name:      req.Name,
+		Color:     req.Color,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := h.repo.InsertTag(&tag); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, &tag)
+}
+
+func (h *TagHandler) HandleUpdateTagById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	tagId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	req := models.TagCreateOrUpdateRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	tag, err := h.repo.GetTagByIdAndUserId(tagId, userId)
+	if err != nil {
+		return err
+	}
+
+	if req.Name != tag.Name {
+		if exists, err := h.repo.CheckTagNameExists(userId, req.Name); err != nil {
+			return err
+		} else if exists {
+			return utils.AlreadyExistsError(fmt.Sprintf("tag '%s' already exists", req.Name))
+		}
+	}
+
+	tag.Name = req.Name
+	tag.Color = req.Color
+
+	if err := h.repo.UpdateTag(tag); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, tag)
+}
+
+func (h *TagHandler) HandleDeleteTagById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	tagId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.repo.DeleteTag(tagId, userId); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleAttachTag tags a todo. Attaching a tag twice is a no-op.
+func (h *TagHandler) HandleAttachTag(w http.ResponseWriter, r *http.Request) error {
+	return h.changeTodoTags(w, r, h.repo.AttachTag)
+}
+
+// HandleDetachTag untags a todo. Detaching a tag it doesn't carry is a no-op.
+func (h *TagHandler) HandleDetachTag(w http.ResponseWriter, r *http.Request) error {
+	return h.changeTodoTags(w, r, h.repo.DetachTag)
+}
+
+func (h *TagHandler) changeTodoTags(w http.ResponseWriter, r *http.Request, change func(todoId, tagId int) error) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	todoId, _ := strconv.Atoi(mux.Vars(r)["id"])
+	tagId, _ := strconv.Atoi(mux.Vars(r)["tagId"])
+
+	// both have to belong to the user
+	if _, err := h.repo.GetTodoByIdAndUserId(todoId, userId); err != nil {
+		return err
+	}
+	if _, err := h.repo.GetTagByIdAndUserId(tagId, userId); err != nil {
+		return err
+	}
+
+	if err := change(todoId, tagId); err != nil {
+		return err
+	}
+
+	todo, err := h.repo.GetTodoByIdAndUserId(todoId, userId)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", utils.VersionETag(todo.Version))
+	return utils.WriteJSON(w, http.StatusOK, todo)
+}
@@ -1,10 +1,20 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/assaidy/todo-api/config"
+	"github.com/assaidy/todo-api/filter"
 	"github.com/assaidy/todo-api/models"
 	"github.com/assaidy/todo-api/repo"
 	"github.com/assaidy/todo-api/utils"
@@ -12,6 +22,11 @@ import (
 	"github.com/gorilla/mux"
 )
 
+const (
+	maxPatchSize         = 1 << 20
+	maxOccurrencePreview = 100
+)
+
 type TodoHandler struct {
 	repo *repo.Repo
 }
@@ -49,18 +64,39 @@ func (h *TodoHandler) HandleCreateTodo(w http.ResponseWriter, r *http.Request) e
 	//     return utils.InvalidRequestData("invalid todo status")
 	// }
 
+	if err := validateTodoRequest(&req); err != nil {
+		return err
+	}
+
+	wf, err := loadWorkflow(h.repo, userId)
+	if err != nil {
+		return err
+	}
+	if err := wf.checkTransition("", req.Status); err != nil {
+		return err
+	}
+	if err := h.checkTodoProject(userId, nil, req.ProjectId); err != nil {
+		return err
+	}
+
 	todo := models.Todo{
-		UserId:      userId,
-		Title:       req.Title,
-		Description: req.Description,
-		Status:      req.Status,
-		CreatedAt:   time.Now().UTC(),
+		UserId:     userId,
+		Priority:   models.DefaultTodoPriority,
+		CreatedAt:  time.Now().UTC(),
+		Occurrence: 1,
+		Tags:       []string{},
 	}
+	applyTodoRequest(&todo, &req)
 
 	if err := h.repo.InsertTodo(&todo); err != nil {
 		return err
 	}
 
+	if err := h.rollUp(wf, userId, todo.ParentId); err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", utils.VersionETag(todo.Version))
 	return utils.WriteJSON(w, http.StatusCreated, &todo)
 }
 
@@ -70,49 +106,392 @@ func (h *TodoHandler) HandleGetAllTodosByUser(w http.ResponseWriter, r *http.Req
 		return utils.ForbiddenError()
 	}
 
-	// check if there's a user with that id
-	if exists, err := h.repo.CheckUserIdExists(userId); err != nil {
+	// the user's time zone is needed to resolve dates in the filters
+	user, err := h.repo.GetUserById(userId)
+	if err != nil {
+		if utils.IsApiError(err, http.StatusNotFound) {
+			return utils.ForbiddenError()
+		}
 		return err
-	} else if !exists {
+	}
+
+	return h.writeTodoPage(w, r, user, nil)
+}
+
+func (h *TodoHandler) HandleGetAllTodosByProject(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
 		return utils.ForbiddenError()
 	}
 
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-	status := r.URL.Query().Get("status")
+	user, err := h.repo.GetUserById(userId)
+	if err != nil {
+		if utils.IsApiError(err, http.StatusNotFound) {
+			return utils.ForbiddenError()
+		}
+		return err
+	}
+
+	projectId, _ := strconv.Atoi(mux.Vars(r)["id"])
 
-	// Default to page 1 and limit 10 if not specified
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+	if _, err := h.repo.GetProjectByIdAndUserId(projectId, userId); err != nil {
+		return err
 	}
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		limit = 10
+
+	return h.writeTodoPage(w, r, user, func(f *repo.TodoFilter) { f.ProjectId = &projectId })
+}
+
+func (h *TodoHandler) HandleGetTodoChildren(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
 	}
-	offset := (page - 1) * limit
 
-	var todos []*models.Todo
-	if status != "" {
-		todos, err = h.repo.GetAllTodosByUserIdWithStatusFilter(userId, limit, offset, status)
-		if err != nil {
-			return err
+	user, err := h.repo.GetUserById(userId)
+	if err != nil {
+		if utils.IsApiError(err, http.StatusNotFound) {
+			return utils.ForbiddenError()
 		}
-	} else {
-		todos, err = h.repo.GetAllTodosByUserId(userId, limit, offset)
+		return err
+	}
+
+	todoId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if _, err := h.repo.GetTodoByIdAndUserId(todoId, userId); err != nil {
+		return err
+	}
+
+	return h.writeTodoPage(w, r, user, func(f *repo.TodoFilter) { f.ParentId = &todoId })
+}
+
+// HandleGetTodosByView lists the todos of a saved view. The query string
+// may narrow it down further, and ?sort= overrides the view's sort.
+func (h *TodoHandler) HandleGetTodosByView(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	user, err := h.repo.GetUserById(userId)
+	if err != nil {
+		if utils.IsApiError(err, http.StatusNotFound) {
+			return utils.ForbiddenError()
+		}
+		return err
+	}
+
+	viewId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	view, err := h.repo.GetSavedViewByIdAndUserId(viewId, userId)
+	if err != nil {
+		return err
+	}
+
+	expr, sort, err := parseSavedView(view)
+	if err != nil {
+		return err
+	}
+
+	return h.writeTodoPage(w, r, user, func(f *repo.TodoFilter) {
+		f.Expr = filter.AndAll(expr, f.Expr)
+		if sort != nil && !r.URL.Query().Has("sort") {
+			f.Sort = sort
+		}
+	})
+}
+
+// writeTodoPage writes the page of the user's todos the query string asks
+// for, narrow limits it further unless it's nil. Without ?cursor= it's the
+// offset pagination clients have always gotten, with ?page= and ?limit=.
+// Clients opt in to the cursor pagination with ?cursor=, empty for the first
+// page, and get the next and prev cursors pointing to the pages around it.
+// Either way the total is counted as ?count= says and the Link header points
+// to the first, previous, next and last page.
+func (h *TodoHandler) writeTodoPage(w http.ResponseWriter, r *http.Request, user *models.User, narrow func(*repo.TodoFilter)) error {
+	q := r.URL.Query()
+
+	filter, err := parseTodoFilter(q, user.Location(), time.Now())
+	if err != nil {
+		return err
+	}
+	if narrow != nil {
+		narrow(&filter)
+	}
+
+	page, limit := parsePage(q)
+
+	total, err := countTodos(h.repo, user.Id, filter, q.Get("count"))
+	if err != nil {
+		return err
+	}
+
+	if !q.Has("cursor") {
+		// one more todo tells whether there's a next page
+		todos, err := h.repo.ListTodos(user.Id, filter, limit+1, (page-1)*limit)
 		if err != nil {
 			return err
 		}
+		hasNext := len(todos) > limit
+		if hasNext {
+			todos = todos[:limit]
+		}
+
+		return writeOffsetPage(w, r, todos, page, limit, total, hasNext)
+	}
+
+	var cursor *repo.TodoCursor
+	if v := q.Get("cursor"); v != "" {
+		cursor = &repo.TodoCursor{}
+		if err := utils.ParseCursor(v, cursor); err != nil {
+			return utils.InvalidRequestData("invalid cursor")
+		}
+		if cursor.Sort != repo.FormatTodoSort(filter.Sort) || (!cursor.End && len(cursor.Values) != len(filter.Sort)) {
+			return utils.InvalidRequestData("the cursor was made for another sort order")
+		}
+	}
+
+	// one more todo tells whether there's another page in that direction
+	todos, err := h.repo.ListTodosAt(user.Id, filter, cursor, limit+1)
+	if err != nil {
+		return err
+	}
+
+	backwards := cursor != nil && cursor.Before
+	more := len(todos) > limit
+	if more && backwards {
+		todos = todos[1:]
+	} else if more {
+		todos = todos[:limit]
+	}
+
+	var next, prev *string
+	if len(todos) > 0 {
+		// coming from a cursor, there's a page on its other side
+		if (more && !backwards) || (backwards && !cursor.End) {
+			if next, err = signTodoCursor(todos[len(todos)-1], filter.Sort, false); err != nil {
+				return err
+			}
+		}
+		if (more && backwards) || (cursor != nil && !backwards) {
+			if prev, err = signTodoCursor(todos[0], filter.Sort, true); err != nil {
+				return err
+			}
+		}
 	}
 
+	last, err := utils.SignCursor(repo.NewTodoEndCursor(filter.Sort))
+	if err != nil {
+		return err
+	}
+
+	cursorLink := func(rel string, cursor string) {
+		link := utils.RequestURLWith(r, map[string]string{"cursor": cursor, "page": ""})
+		if cursor == "" {
+			// an empty cursor still keeps to the cursor pagination
+			if strings.Contains(link, "?") {
+				link += "&cursor="
+			} else {
+				link += "?cursor="
+			}
+		}
+		utils.AddLink(w, rel, link)
+	}
+	cursorLink("first", "")
+	if prev != nil {
+		cursorLink("prev", *prev)
+	}
+	if next != nil {
+		cursorLink("next", *next)
+	}
+	cursorLink("last", last)
+
 	return utils.WriteJSON(w, http.StatusOK, map[string]any{
-		"data":  todos,
-		"page":  page,
-		"limit": limit,
-		"total": len(todos),
+		"data":       todos,
+		"limit":      limit,
+		"next":       next,
+		"prev":       prev,
+		"hasNext":    next != nil,
+		"total":      total,
+		"totalPages": totalPages(total, limit),
 	})
 }
 
+// writeOffsetPage writes data, a page of a list in the legacy offset
+// pagination, with its metadata and the Link header pointing to the first,
+// previous, next and last page.
+func writeOffsetPage(w http.ResponseWriter, r *http.Request, data any, page, limit int, total *int, hasNext bool) error {
+	pages := totalPages(total, limit)
+
+	pageLink := func(rel string, page int) {
+		utils.AddLink(w, rel, utils.RequestURLWith(r, map[string]string{"page": strconv.Itoa(page)}))
+	}
+	pageLink("first", 1)
+	if page > 1 {
+		pageLink("prev", page-1)
+	}
+	if hasNext {
+		pageLink("next", page+1)
+	}
+	if pages != nil {
+		pageLink("last", max(*pages, 1))
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"data":       data,
+		"page":       page,
+		"limit":      limit,
+		"total":      total,
+		"totalPages": pages,
+		"hasNext":    hasNext,
+	})
+}
+
+// totalPages returns how many pages of limit items total makes, nil if
+// it's not known.
+func totalPages(total *int, limit int) *int {
+	if total == nil {
+		return nil
+	}
+	pages := (*total + limit - 1) / limit
+	return &pages
+}
+
+// countTodos counts the todos matching filter the way ?count= asks for:
+// exactly (the default), estimated by the query planner, or not at all, nil.
+func countTodos(db *repo.Repo, userId int, filter repo.TodoFilter, mode string) (*int, error) {
+	var (
+		count int
+		err   error
+	)
+	switch mode {
+	case "", "exact":
+		count, err = db.CountTodos(userId, filter)
+	case "estimated":
+		count, err = db.EstimateTodos(userId, filter)
+	case "none":
+		return nil, nil
+	default:
+		return nil, utils.InvalidRequestData("count must be one of exact, estimated or none")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &count, nil
+}
+
+func signTodoCursor(todo *models.Todo, keys []repo.TodoSortKey, before bool) (*string, error) {
+	cursor, err := utils.SignCursor(repo.NewTodoCursor(todo, keys, before))
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// HandleSearchTodos searches the titles and descriptions of the user's todos
+// for ?q=, see utils.ParseSearchQuery. The filters of the todo list apply
+// too, results come in ?page= pages counted as ?count= says.
+func (h *TodoHandler) HandleSearchTodos(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	user, err := h.repo.GetUserById(userId)
+	if err != nil {
+		if utils.IsApiError(err, http.StatusNotFound) {
+			return utils.ForbiddenError()
+		}
+		return err
+	}
+
+	q := r.URL.Query()
+
+	search, err := utils.ParseSearchQuery(q.Get("q"))
+	if err != nil {
+		return utils.InvalidRequestData("q must contain at least one word to search for, other than common words like 'the'")
+	}
+
+	page, limit := parsePage(q)
+	offset := (page - 1) * limit
+
+	filter, err := parseTodoFilter(q, user.Location(), time.Now())
+	if err != nil {
+		return err
+	}
+	filter.Search = search
+	// results are ranked unless asked for another order
+	if q.Get("sort") == "" {
+		filter.Sort = nil
+	}
+
+	total, err := countTodos(h.repo, userId, filter, q.Get("count"))
+	if err != nil {
+		return err
+	}
+
+	// one more result tells whether there's a next page
+	results, err := h.repo.SearchTodos(userId, filter, limit+1, offset)
+	if err != nil {
+		return err
+	}
+	hasNext := len(results) > limit
+	if hasNext {
+		results = results[:limit]
+	}
+
+	return writeOffsetPage(w, r, results, page, limit, total, hasNext)
+}
+
+// parsePage reads ?page= and ?limit=, they default to page 1 and limit 10
+// if not specified. The limit is capped to config.MaxPageLimit.
+func parsePage(q url.Values) (page, limit int) {
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err = strconv.Atoi(q.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	return page, min(limit, config.MaxPageLimit)
+}
+
+func (h *TodoHandler) HandleGetTodoById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	// check if there's a user with that id
+	if exists, err := h.repo.CheckUserIdExists(userId); err != nil {
+		return err
+	} else if !exists {
+		return utils.ForbiddenError()
+	}
+
+	todoId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	// todos of other users are reported as missing, not forbidden
+	todo, err := h.repo.GetTodoByIdAndUserId(todoId, userId)
+	if err != nil {
+		return err
+	}
+
+	etag := utils.VersionETag(todo.Version)
+
+	// clients may cache the todo, but have to revalidate it every time
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if utils.ETagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, todo)
+}
+
 func (h *TodoHandler) HandleDeleteAllTodosByUser(w http.ResponseWriter, r *http.Request) error {
 	userId, ok := utils.GetUserIdFromContext(r.Context())
 	if !ok {
@@ -148,8 +527,31 @@ func (h *TodoHandler) HandleDeleteTodoById(w http.ResponseWriter, r *http.Reques
 
 	todoId, _ := strconv.Atoi(mux.Vars(r)["id"])
 
-	if err := h.repo.DeleteTodoByIdAndUserId(todoId, userId); err != nil {
-		return err
+	version := 0
+	if r.Header.Get("If-Match") != "" {
+		todo, err := h.repo.GetTodoByIdAndUserId(todoId, userId)
+		if err != nil {
+			return err
+		}
+		if version, err = ifMatchVersion(r, todo); err != nil {
+			return h.writePreconditionFailed(w, err, todoId, userId)
+		}
+	}
+
+	parentId, err := h.repo.DeleteTodoByIdAndUserId(todoId, userId, version)
+	if err != nil {
+		return h.writePreconditionFailed(w, err, todoId, userId)
+	}
+
+	// the parent may be done now that one of its subtasks is gone
+	if parentId != nil {
+		wf, err := loadWorkflow(h.repo, userId)
+		if err != nil {
+			return err
+		}
+		if err := h.rollUp(wf, userId, parentId); err != nil {
+			return err
+		}
 	}
 
 	return utils.WriteJSON(w, http.StatusNoContent, nil)
@@ -170,22 +572,541 @@ func (h *TodoHandler) HandleUpdateTodoById(w http.ResponseWriter, r *http.Reques
 
 	todoId, _ := strconv.Atoi(mux.Vars(r)["id"])
 
+	current, err := h.repo.GetTodoByIdAndUserId(todoId, userId)
+	if err != nil {
+		return err
+	}
+
+	version, err := ifMatchVersion(r, current)
+	if err != nil {
+		return h.writePreconditionFailed(w, err, todoId, userId)
+	}
+
 	req := models.TodoCreateOrUpdateRequest{}
 	if err := utils.ParseJSON(r, &req); err != nil {
 		return err
 	}
 
-	todo := models.Todo{
-		Id:          todoId,
-		UserId:      userId,
-		Title:       req.Title,
-		Description: req.Description,
-		Status:      req.Status,
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(errors.Error())
+	}
+
+	if err := validateTodoRequest(&req); err != nil {
+		return err
+	}
+
+	wf, err := loadWorkflow(h.repo, userId)
+	if err != nil {
+		return err
+	}
+	if err := wf.checkTransition(current.Status, req.Status); err != nil {
+		return err
+	}
+	if err := h.checkTodoProject(userId, current.ProjectId, req.ProjectId); err != nil {
+		return err
+	}
+
+	todo := *current
+	applyTodoRequest(&todo, &req)
+
+	// the next occurrence is created along with the status change, so a
+	// finished todo never goes without one
+	next, err := h.nextOccurrence(wf, current, &todo)
+	if err != nil {
+		return err
+	}
+
+	if err := h.repo.UpdateTodo(&todo, version, next); err != nil {
+		return h.writePreconditionFailed(w, err, todoId, userId)
 	}
 
-	if err := h.repo.UpdateTodo(&todo); err != nil {
+	if err := h.afterTodoUpdate(wf, current, &todo); err != nil {
 		return err
 	}
 
+	w.Header().Set("ETag", utils.VersionETag(todo.Version))
 	return utils.WriteJSON(w, http.StatusOK, &todo)
 }
+
+func (h *TodoHandler) HandlePatchTodoById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	// check if there's a user with that id
+	if exists, err := h.repo.CheckUserIdExists(userId); err != nil {
+		return err
+	} else if !exists {
+		return utils.ForbiddenError()
+	}
+
+	todoId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	todo, err := h.repo.GetTodoByIdAndUserId(todoId, userId)
+	if err != nil {
+		return err
+	}
+
+	version, err := ifMatchVersion(r, todo)
+	if err != nil {
+		return h.writePreconditionFailed(w, err, todoId, userId)
+	}
+
+	// the patch is applied to the same document PUT takes
+	req, err := applyPatch(w, r, todoToRequest(todo))
+	if err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(errors.Error())
+	}
+
+	if err := validateTodoRequest(req); err != nil {
+		return err
+	}
+
+	wf, err := loadWorkflow(h.repo, userId)
+	if err != nil {
+		return err
+	}
+	if err := wf.checkTransition(todo.Status, req.Status); err != nil {
+		return err
+	}
+	if err := h.checkTodoProject(userId, todo.ProjectId, req.ProjectId); err != nil {
+		return err
+	}
+
+	patched := *todo
+	applyTodoRequest(&patched, req)
+
+	// without If-Match only the changed columns are written, so a concurrent
+	// update of other fields isn't lost
+	if changes := changedTodoColumns(todo, &patched); len(changes) > 0 {
+		next, err := h.nextOccurrence(wf, todo, &patched)
+		if err != nil {
+			return err
+		}
+
+		patched.Version, err = h.repo.UpdateTodoColumns(todoId, userId, version, changes, next)
+		if err != nil {
+			return h.writePreconditionFailed(w, err, todoId, userId)
+		}
+	}
+
+	if err := h.afterTodoUpdate(wf, todo, &patched); err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", utils.VersionETag(patched.Version))
+	return utils.WriteJSON(w, http.StatusOK, &patched)
+}
+
+func (h *TodoHandler) HandleGetTodoOccurrences(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	user, err := h.repo.GetUserById(userId)
+	if err != nil {
+		if utils.IsApiError(err, http.StatusNotFound) {
+			return utils.ForbiddenError()
+		}
+		return err
+	}
+
+	todoId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	todo, err := h.repo.GetTodoByIdAndUserId(todoId, userId)
+	if err != nil {
+		return err
+	}
+	if todo.Recurrence == nil || todo.DueAt == nil {
+		return utils.InvalidRequestData(fmt.Sprintf("todo with id %d doesn't recur", todoId))
+	}
+
+	// Default to the next 5 occurrences
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 1 {
+		count = 5
+	}
+	count = min(count, maxOccurrencePreview)
+
+	rule, err := utils.ParseRRule(*todo.Recurrence)
+	if err != nil {
+		return err
+	}
+
+	loc := user.Location()
+	times, positions := rule.Occurrences(recurrenceStart(todo).In(loc), todo.DueAt.In(loc), count)
+
+	occurrences := make([]models.TodoOccurrence, len(times))
+	for i := range times {
+		occurrences[i] = models.TodoOccurrence{Occurrence: positions[i], DueAt: times[i].UTC()}
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"data": occurrences,
+	})
+}
+
+// nextOccurrence returns the todo that follows a recurring one once it
+// moves to a terminal status, nil if it doesn't. Inserting it is idempotent,
+// so a todo that's reopened and finished again doesn't get a second one.
+func (h *TodoHandler) nextOccurrence(wf workflow, before, after *models.Todo) (*models.Todo, error) {
+	if wf.isTerminal(before.Status) || !wf.isTerminal(after.Status) || after.Recurrence == nil || after.DueAt == nil {
+		return nil, nil
+	}
+
+	user, err := h.repo.GetUserById(after.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	rule, err := utils.ParseRRule(*after.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	// occurrences are computed in the user's time zone, so they keep their
+	// local time across DST changes
+	loc := user.Location()
+	due, occurrence, ok := rule.Next(recurrenceStart(after).In(loc), after.DueAt.In(loc))
+	if !ok {
+		// the series is over
+		return nil, nil
+	}
+	due = due.UTC()
+
+	next := models.Todo{
+		UserId:          after.UserId,
+		Title:           after.Title,
+		Description:     after.Description,
+		Status:          wf.initial(),
+		Priority:        after.Priority,
+		ProjectId:       after.ProjectId,
+		ParentId:        after.ParentId,
+		AutoComplete:    after.AutoComplete,
+		CreatedAt:       time.Now().UTC(),
+		DueAt:           &due,
+		Recurrence:      after.Recurrence,
+		RecurrenceStart: after.RecurrenceStart,
+		Occurrence:      occurrence,
+		SeriesId:        after.SeriesId,
+	}
+	if next.SeriesId == nil {
+		next.SeriesId = &after.Id
+	}
+	// the reminder keeps its distance to the due date
+	if after.RemindAt != nil {
+		remindAt := due.Add(after.RemindAt.Sub(*after.DueAt))
+		next.RemindAt = &remindAt
+	}
+
+	return &next, nil
+}
+
+func recurrenceStart(todo *models.Todo) time.Time {
+	if todo.RecurrenceStart != nil {
+		return *todo.RecurrenceStart
+	}
+	return *todo.DueAt
+}
+
+// ifMatchVersion checks the If-Match header against todo and returns the
+// version the write has to be conditioned on, 0 if there's no If-Match header.
+func ifMatchVersion(r *http.Request, todo *models.Todo) (int, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, nil
+	}
+
+	if !utils.IfMatch(header, utils.VersionETag(todo.Version)) {
+		return 0, utils.PreconditionFailedError(fmt.Sprintf("todo with id %d has been modified", todo.Id))
+	}
+
+	return todo.Version, nil
+}
+
+// writePreconditionFailed answers a stale If-Match with the current todo, so
+// the client can reapply its change without fetching it again. Other errors
+// are returned as they are.
+func (h *TodoHandler) writePreconditionFailed(w http.ResponseWriter, err error, todoId, userId int) error {
+	if !utils.IsApiError(err, http.StatusPreconditionFailed) {
+		return err
+	}
+
+	todo, err := h.repo.GetTodoByIdAndUserId(todoId, userId)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", utils.VersionETag(todo.Version))
+	return utils.WriteJSON(w, http.StatusPreconditionFailed, todo)
+}
+
+func todoToRequest(todo *models.Todo) *models.TodoCreateOrUpdateRequest {
+	return &models.TodoCreateOrUpdateRequest{
+		Title:        todo.Title,
+		Description:  todo.Description,
+		Status:       todo.Status,
+		Priority:     &todo.Priority,
+		ProjectId:    todo.ProjectId,
+		ParentId:     todo.ParentId,
+		AutoComplete: todo.AutoComplete,
+		DueAt:        todo.DueAt,
+		RemindAt:     todo.RemindAt,
+		Recurrence:   todo.Recurrence,
+	}
+}
+
+// applyTodoRequest sets the fields of todo a create or update request controls.
+// Changing the recurrence rule starts a new series with todo as its first occurrence.
+func applyTodoRequest(todo *models.Todo, req *models.TodoCreateOrUpdateRequest) {
+	todo.Title = req.Title
+	todo.Description = req.Description
+	todo.Status = req.Status
+	if req.Priority != nil {
+		todo.Priority = *req.Priority
+	}
+	todo.ProjectId = req.ProjectId
+	todo.ParentId = req.ParentId
+	todo.AutoComplete = req.AutoComplete
+	todo.DueAt = utcTime(req.DueAt)
+	todo.RemindAt = utcTime(req.RemindAt)
+
+	if !sameString(todo.Recurrence, req.Recurrence) {
+		todo.Recurrence = req.Recurrence
+		todo.RecurrenceStart = nil
+		if req.Recurrence != nil {
+			todo.RecurrenceStart = todo.DueAt
+		}
+		todo.Occurrence = 1
+		todo.SeriesId = nil
+	}
+}
+
+// changedTodoColumns maps the columns that differ between todo and updated to their new value.
+func changedTodoColumns(todo, updated *models.Todo) map[string]any {
+	changes := map[string]any{}
+	if updated.Title != todo.Title {
+		changes["title"] = updated.Title
+	}
+	if updated.Description != todo.Description {
+		changes["description"] = updated.Description
+	}
+	if updated.Status != todo.Status {
+		changes["status"] = updated.Status
+	}
+	if updated.Priority != todo.Priority {
+		changes["priority"] = updated.Priority
+	}
+	if !sameInt(updated.ProjectId, todo.ProjectId) {
+		changes["project_id"] = updated.ProjectId
+	}
+	if !sameInt(updated.ParentId, todo.ParentId) {
+		changes["parent_id"] = updated.ParentId
+	}
+	if updated.AutoComplete != todo.AutoComplete {
+		changes["auto_complete"] = updated.AutoComplete
+	}
+	if !sameTime(updated.DueAt, todo.DueAt) {
+		changes["due_at"] = updated.DueAt
+	}
+	if !sameTime(updated.RemindAt, todo.RemindAt) {
+		changes["remind_at"] = updated.RemindAt
+	}
+	if !sameString(updated.Recurrence, todo.Recurrence) {
+		changes["rrule"] = updated.Recurrence
+	}
+	if !sameTime(updated.RecurrenceStart, todo.RecurrenceStart) {
+		changes["recurrence_start"] = updated.RecurrenceStart
+	}
+	if updated.Occurrence != todo.Occurrence {
+		changes["occurrence"] = updated.Occurrence
+	}
+	if !sameInt(updated.SeriesId, todo.SeriesId) {
+		changes["series_id"] = updated.SeriesId
+	}
+	return changes
+}
+
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// utcTime normalizes request times, they're stored without a time zone.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// checkTodoProject checks that a todo can be moved from one project to
+// another: it has to be one of the user's projects and not archived. Both
+// are nil for the inbox.
+func (h *TodoHandler) checkTodoProject(userId int, from, to *int) error {
+	if to == nil || sameInt(from, to) {
+		return nil
+	}
+
+	project, err := h.repo.GetProjectByIdAndUserId(*to, userId)
+	if err != nil {
+		if utils.IsApiError(err, http.StatusNotFound) {
+			return utils.InvalidRequestData(fmt.Sprintf("no project with id %d found", *to))
+		}
+		return err
+	}
+	if project.Archived {
+		return utils.ConflictError(fmt.Sprintf("project '%s' is archived", project.Name))
+	}
+
+	return nil
+}
+
+// afterTodoUpdate follows up on an update from before to after: the progress
+// of the parents the todo left or joined changes.
+func (h *TodoHandler) afterTodoUpdate(wf workflow, before, after *models.Todo) error {
+	if !sameInt(before.ParentId, after.ParentId) {
+		if err := h.rollUp(wf, after.UserId, before.ParentId); err != nil {
+			return err
+		}
+		return h.rollUp(wf, after.UserId, after.ParentId)
+	}
+
+	// finishing or reopening a subtask changes the progress of its parent,
+	// so does the next occurrence a finished one may have gotten
+	if wf.isTerminal(before.Status) != wf.isTerminal(after.Status) {
+		return h.rollUp(wf, after.UserId, after.ParentId)
+	}
+
+	return nil
+}
+
+// rollUp updates the todo with id parentId after the progress of its subtasks
+// changed. If it auto-completes and all its subtasks are finished, it's moved
+// to the first terminal status it can move to, which may in turn finish its
+// own parent.
+func (h *TodoHandler) rollUp(wf workflow, userId int, parentId *int) error {
+	for parentId != nil {
+		parent, err := h.repo.GetTodoByIdAndUserId(*parentId, userId)
+		if err != nil {
+			if utils.IsApiError(err, http.StatusNotFound) {
+				// deleted in the meantime
+				return nil
+			}
+			return err
+		}
+
+		status := ""
+		if parent.AutoComplete && parent.Progress != nil && parent.Progress.Done == parent.Progress.Total && !wf.isTerminal(parent.Status) {
+			status = wf.completion(parent.Status)
+		}
+		if status == "" {
+			// only the progress changed
+			return h.repo.BumpTodoVersion(parent.Id)
+		}
+
+		completed := *parent
+		completed.Status = status
+		next, err := h.nextOccurrence(wf, parent, &completed)
+		if err != nil {
+			return err
+		}
+
+		completed.Version, err = h.repo.UpdateTodoColumns(parent.Id, userId, 0, map[string]any{"status": status}, next)
+		if err != nil {
+			return err
+		}
+
+		parentId = parent.ParentId
+	}
+
+	return nil
+}
+
+// validateTodoRequest checks what the validate tags can't, and normalizes the recurrence rule.
+func validateTodoRequest(req *models.TodoCreateOrUpdateRequest) error {
+	if req.DueAt != nil && req.RemindAt != nil && req.RemindAt.After(*req.DueAt) {
+		return utils.InvalidRequestData("remindAt must not be after dueAt")
+	}
+
+	if req.Recurrence != nil {
+		if req.DueAt == nil {
+			return utils.InvalidRequestData("a recurring todo needs a dueAt")
+		}
+		rule, err := utils.ParseRRule(*req.Recurrence)
+		if err != nil {
+			return utils.InvalidRequestData(err.Error())
+		}
+		normalized := rule.String()
+		req.Recurrence = &normalized
+	}
+
+	return nil
+}
+
+// applyPatch applies the JSON Merge Patch or JSON Patch in the request body,
+// depending on its Content-Type, to doc and decodes the result into a new T.
+// Plain application/json is treated as a merge patch.
+func applyPatch[T any](w http.ResponseWriter, r *http.Request, doc *T) (*T, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	if err != nil {
+		return nil, utils.InvalidRequestData("request body too large")
+	}
+
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case utils.JSONPatchContentType:
+		patched, err = utils.ApplyJSONPatch(original, body)
+	case utils.MergePatchContentType, "application/json", "":
+		patched, err = utils.ApplyMergePatch(original, body)
+	default:
+		return nil, utils.NewApiError(http.StatusUnsupportedMediaType,
+			fmt.Sprintf("unsupported patch format, use %s or %s", utils.MergePatchContentType, utils.JSONPatchContentType))
+	}
+	if err != nil {
+		if errors.Is(err, utils.ErrPatchTestFailed) {
+			return nil, utils.ConflictError(err.Error())
+		}
+		return nil, utils.InvalidRequestData(err.Error())
+	}
+
+	result := new(T)
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(result); err != nil {
+		return nil, utils.InvalidRequestData(fmt.Sprintf("patched document is invalid: %s", err))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/assaidy/todo-api/filter"
+	"github.com/assaidy/todo-api/repo"
+	"github.com/assaidy/todo-api/utils"
+)
+
+const dateLayout = "2006-01-02"
+
+// parseTodoFilter reads the list filters from the query string. Plain dates
+// and relative ones like ?due=today are resolved in loc, the user's time zone.
+//
+//	?status=doing
+//	?filter=status in (todo, doing) and title ~ "report", see package filter
+//	  and repo.todoFilterFields for the fields
+//	?project=inbox or a project id
+//	?parent=none for top level todos or the id of a todo for its subtasks
+//	?due_before=2024-05-01 or an RFC 3339 timestamp, ?due_after=...
+//	?due=today|tomorrow|week|none|any
+//	?overdue=true
+//	?tag=work&tag=urgent with ?tag_mode=any (default) or all
+//	?sort=-priority,due_at,title, see repo.ParseTodoSort
+func parseTodoFilter(q url.Values, loc *time.Location, now time.Time) (repo.TodoFilter, error) {
+	f := repo.TodoFilter{
+		Location: loc,
+		Now:      now,
+	}
+
+	// ?status= is a shorthand for a filter on the status
+	var status filter.Expr
+	if v := q.Get("status"); v != "" {
+		status = filter.Comparison{Field: "status", Op: filter.OpEq, Values: []string{v}}
+	}
+	var expr filter.Expr
+	if v := q.Get("filter"); v != "" {
+		var err error
+		if expr, err = filter.Parse(v); err != nil {
+			return f, utils.InvalidRequestData(err.Error())
+		}
+	}
+	f.Expr = filter.AndAll(status, expr)
+
+	if v := q.Get("project"); v != "" {
+		projectId := 0
+		if v != "inbox" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id < 1 {
+				return f, utils.InvalidRequestData("project must be inbox or a project id")
+			}
+			projectId = id
+		}
+		f.ProjectId = &projectId
+	}
+
+	if v := q.Get("parent"); v != "" {
+		parentId := 0
+		if v != "none" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id < 1 {
+				return f, utils.InvalidRequestData("parent must be none or a todo id")
+			}
+			parentId = id
+		}
+		f.ParentId = &parentId
+	}
+
+	if v := q.Get("due_before"); v != "" {
+		// due before a day means before it starts
+		t, _, err := parseDueBound(v, loc)
+		if err != nil {
+			return f, utils.InvalidRequestData("due_before must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+		}
+		f.DueBefore = &t
+	}
+
+	if v := q.Get("due_after"); v != "" {
+		t, isDate, err := parseDueBound(v, loc)
+		if err != nil {
+			return f, utils.InvalidRequestData("due_after must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+		}
+		// due after a day means from the next one on
+		if isDate {
+			t = t.AddDate(0, 0, 1)
+		}
+		f.DueAfter = &t
+	}
+
+	if v := q.Get("due"); v != "" {
+		today := startOfDay(now, loc)
+		var from, to time.Time
+		switch v {
+		case "today":
+			from, to = today, today.AddDate(0, 0, 1)
+		case "tomorrow":
+			from, to = today.AddDate(0, 0, 1), today.AddDate(0, 0, 2)
+		case "week":
+			// today and the six days after it
+			from, to = today, today.AddDate(0, 0, 7)
+		case "none", "any":
+			hasDueDate := v == "any"
+			f.HasDueDate = &hasDueDate
+		default:
+			return f, utils.InvalidRequestData("due must be one of today, tomorrow, week, none or any")
+		}
+		if v != "none" && v != "any" {
+			f.DueAfter = laterOf(f.DueAfter, from)
+			f.DueBefore = earlierOf(f.DueBefore, to)
+		}
+	}
+
+	if v := q.Get("overdue"); v != "" {
+		overdue, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, utils.InvalidRequestData("overdue must be true or false")
+		}
+		if overdue {
+			f.OverdueAt = &now
+		}
+	}
+
+	for _, tag := range q["tag"] {
+		if tag != "" {
+			f.Tags = append(f.Tags, tag)
+		}
+	}
+	switch v := q.Get("tag_mode"); v {
+	case "", repo.TagModeAny:
+		f.TagMode = repo.TagModeAny
+	case repo.TagModeAll:
+		f.TagMode = repo.TagModeAll
+	default:
+		return f, utils.InvalidRequestData("tag_mode must be any or all")
+	}
+
+	sort, err := repo.ParseTodoSort(q.Get("sort"))
+	if err != nil {
+		return f, utils.InvalidRequestData(err.Error())
+	}
+	f.Sort = sort
+
+	return f, nil
+}
+
+// parseDueBound parses an RFC 3339 timestamp, or a date which is taken as
+// the start of that day in loc.
+func parseDueBound(v string, loc *time.Location) (t time.Time, isDate bool, err error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+
+	t, err = time.ParseInLocation(dateLayout, v, loc)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, true, nil
+}
+
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+func laterOf(t *time.Time, other time.Time) *time.Time {
+	if t != nil && t.After(other) {
+		return t
+	}
+	return &other
+}
+
+func earlierOf(t *time.Time, other time.Time) *time.Time {
+	if t != nil && t.Before(other) {
+		return t
+	}
+	return &other
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/repo"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type TokenHandler struct {
+	repo *repo.Repo
+}
+
+func NewTokenHandler(r *repo.Repo) *TokenHandler {
+	return &TokenHandler{
+		repo: r,
+	}
+}
+
+func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) error {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok || id != userId {
+		return utils.ForbiddenError()
+	}
+
+	req := models.PersonalAccessTokenCreateRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	tokenString, hash, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		return err
+	}
+
+	token := models.PersonalAccessToken{
+		UserId:    userId,
+		Name:      req.Name,
+		TokenHash: hash,
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if token.ExpiresAt != nil {
+		expiresAt := token.ExpiresAt.UTC()
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := h.repo.InsertPersonalAccessToken(&token); err != nil {
+		return err
+	}
+
+	// the plain token is only ever shown here
+	return utils.WriteJSON(w, http.StatusCreated, map[string]any{
+		"token":         tokenString,
+		"tokenMetadata": token,
+	})
+}
+
+func (h *TokenHandler) HandleGetAllTokensByUser(w http.ResponseWriter, r *http.Request) error {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok || id != userId {
+		return utils.ForbiddenError()
+	}
+
+	tokens, err := h.repo.GetAllPersonalAccessTokensByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"data": tokens,
+	})
+}
+
+func (h *TokenHandler) HandleDeleteTokenById(w http.ResponseWriter, r *http.Request) error {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok || id != userId {
+		return utils.ForbiddenError()
+	}
+
+	tokenId, _ := strconv.Atoi(mux.Vars(r)["tokenId"])
+
+	if err := h.repo.DeletePersonalAccessTokenByIdAndUserId(tokenId, userId); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusNoContent, nil)
+}
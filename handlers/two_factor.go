@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/assaidy/todo-api/config"
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/repo"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+const recoveryCodesCount = 10
+
+type TwoFactorHandler struct {
+	repo *repo.Repo
+}
+
+func NewTwoFactorHandler(r *repo.Repo) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		repo: r,
+	}
+}
+
+func (h *TwoFactorHandler) HandleEnrollTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	user, err := h.repo.GetUserById(id)
+	if err != nil {
+		return err
+	}
+
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok || user.Id != userId {
+		return utils.ForbiddenError()
+	}
+
+	totp, err := h.repo.GetTOTPByUserId(user.Id)
+	if err != nil {
+		return err
+	}
+	if totp != nil && totp.ConfirmedAt != nil {
+		return utils.InvalidRequestData("two-factor authentication is already enabled")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return err
+	}
+
+	encryptedSecret, err := utils.Encrypt(config.TOTPEncryptionKey, secret)
+	if err != nil {
+		return err
+	}
+
+	if err := h.repo.UpsertTOTP(user.Id, encryptedSecret); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, map[string]any{
+		"secret": secret,
+		"uri":    utils.TOTPURI(secret, user.Email, config.TOTPIssuer),
+	})
+}
+
+func (h *TwoFactorHandler) HandleConfirmTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok || id != userId {
+		return utils.ForbiddenError()
+	}
+
+	req := models.TwoFactorConfirmRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	totp, err := h.repo.GetTOTPByUserId(userId)
+	if err != nil {
+		return err
+	}
+	if totp == nil {
+		return utils.InvalidRequestData("two-factor enrollment wasn't started")
+	}
+	if totp.ConfirmedAt != nil {
+		return utils.InvalidRequestData("two-factor authentication is already enabled")
+	}
+
+	if ok, err := h.verifyTOTPCode(totp, req.Code); err != nil {
+		return err
+	} else if !ok {
+		return utils.InvalidRequestData("invalid two-factor code")
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		return err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+
+	if err := h.repo.ConfirmTOTP(userId, hashes); err != nil {
+		return err
+	}
+
+	// the plain recovery codes are only ever shown here
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"recoveryCodes": codes,
+	})
+}
+
+func (h *TwoFactorHandler) HandleDisableTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok || id != userId {
+		return utils.ForbiddenError()
+	}
+
+	req := models.TwoFactorVerifyRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	totp, err := h.repo.GetTOTPByUserId(userId)
+	if err != nil {
+		return err
+	}
+	if totp == nil || totp.ConfirmedAt == nil {
+		return utils.InvalidRequestData("two-factor authentication isn't enabled")
+	}
+
+	if err := h.checkSecondFactor(w, totp, &req); err != nil {
+		return err
+	}
+
+	if err := h.repo.DeleteTOTP(userId); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *TwoFactorHandler) HandleLoginTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	req := models.TwoFactorLoginRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	userId, challenge, err := utils.ParseChallengeToken(req.ChallengeToken)
+	if err != nil {
+		return utils.UnauthorizedError()
+	}
+
+	// challenges are single-use
+	if revoked, err := h.repo.IsTokenRevoked(challenge.Id, userId, challenge.IssuedAt); err != nil {
+		return err
+	} else if revoked {
+		return utils.UnauthorizedError()
+	}
+
+	totp, err := h.repo.GetTOTPByUserId(userId)
+	if err != nil {
+		return err
+	}
+	if totp == nil || totp.ConfirmedAt == nil {
+		return utils.UnauthorizedError()
+	}
+
+	if err := h.checkSecondFactor(w, totp, &req.TwoFactorVerifyRequest); err != nil {
+		return err
+	}
+
+	if err := h.repo.RevokeToken(challenge.Id, userId, challenge.ExpiresAt); err != nil {
+		return err
+	}
+
+	user, err := h.repo.GetUserById(userId)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := issueTokens(h.repo, user.Id)
+	if err != nil {
+		return err
+	}
+
+	return writeSession(w, http.StatusOK, tokens, user)
+}
+
+// checkSecondFactor verifies the code or recovery code in req. Failures are
+// throttled like failed logins, since a 6 digit code is easy to guess otherwise.
+func (h *TwoFactorHandler) checkSecondFactor(w http.ResponseWriter, totp *models.TOTP, req *models.TwoFactorVerifyRequest) error {
+	key := "2fa:" + strconv.Itoa(totp.UserId)
+	if err := beginLoginAttempt(w, h.repo, loginLimit{key: key, maxAttempts: config.LoginMaxAttemptsPerAccount}); err != nil {
+		return err
+	}
+
+	var (
+		ok  bool
+		err error
+	)
+	if req.Code != "" {
+		ok, err = h.verifyTOTPCode(totp, req.Code)
+	} else {
+		ok, err = h.repo.UseRecoveryCode(totp.UserId, utils.HashRecoveryCode(req.RecoveryCode))
+	}
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return utils.NewApiError(http.StatusUnauthorized, "invalid two-factor code")
+	}
+
+	return h.repo.ResetLoginFailures(key)
+}
+
+// verifyTOTPCode checks code against the user's secret and burns its time step.
+func (h *TwoFactorHandler) verifyTOTPCode(totp *models.TOTP, code string) (bool, error) {
+	secret, err := utils.Decrypt(config.TOTPEncryptionKey, totp.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return h.repo.UseTOTPStep(totp.UserId, step)
+}
@@ -6,6 +6,8 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/assaidy/todo-api/config"
+	"github.com/assaidy/todo-api/mailer"
 	"github.com/assaidy/todo-api/models"
 	"github.com/assaidy/todo-api/repo"
 	"github.com/assaidy/todo-api/utils"
@@ -14,12 +16,14 @@ import (
 )
 
 type UserHandler struct {
-	repo *repo.Repo
+	repo   *repo.Repo
+	mailer mailer.Mailer
 }
 
-func NewUserHandler(r *repo.Repo) *UserHandler {
+func NewUserHandler(r *repo.Repo, m mailer.Mailer) *UserHandler {
 	return &UserHandler{
-		repo: r,
+		repo:   r,
+		mailer: m,
 	}
 }
 
@@ -42,7 +46,7 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 		return utils.AlreadyExistsError(fmt.Sprintf("email '%s' is already taken", req.Email))
 	}
 
-	encryptedPassword, err := utils.Encrypt(req.Password)
+	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
 		return err
 	}
@@ -50,23 +54,28 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 	user := models.User{
 		Name:     req.Name,
 		Email:    req.Email,
-		Password: encryptedPassword,
+		Password: hashedPassword,
+		Timezone: req.Timezone,
 		JoinedAt: time.Now().UTC(),
 	}
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
 
 	if err := h.repo.InsertUser(&user); err != nil {
 		return err
 	}
 
-	token, err := utils.CreateToken(user.Id)
+	if err := sendVerificationEmail(h.repo, h.mailer, &user); err != nil {
+		return err
+	}
+
+	tokens, err := issueTokens(h.repo, user.Id)
 	if err != nil {
 		return err
 	}
 
-	return utils.WriteJSON(w, http.StatusCreated, map[string]any{
-		"token": token,
-		"user":  user,
-	})
+	return writeSession(w, http.StatusCreated, tokens, &user)
 }
 
 func (h *UserHandler) HandleLoginUser(w http.ResponseWriter, r *http.Request) error {
@@ -80,29 +89,72 @@ func (h *UserHandler) HandleLoginUser(w http.ResponseWriter, r *http.Request) er
 		return utils.InvalidRequestData(validationErrors.Error())
 	}
 
+	ipKey, accountKey := loginAttemptKeys(r, req.Email)
+	ipLimit := loginLimit{key: ipKey, maxAttempts: config.LoginMaxAttemptsPerIP}
+	accountLimit := loginLimit{key: accountKey, maxAttempts: config.LoginMaxAttemptsPerAccount}
+	if err := beginLoginAttempt(w, h.repo, ipLimit, accountLimit); err != nil {
+		return err
+	}
+
+	// unknown emails and wrong passwords must look the same to the client
 	user, err := h.repo.GetUserByEmail(req.Email)
 	if err != nil {
-		return err
+		if !utils.IsApiError(err, http.StatusNotFound) {
+			return err
+		}
+		utils.DummyVerifyPassword(req.Password)
+		return utils.InvalidCredentialsError()
 	}
 
-	dencryptedPassword, err := utils.Decrypt(user.Password)
+	match, needsRehash, err := utils.VerifyPassword(req.Password, user.Password)
 	if err != nil {
 		return err
 	}
+	if !match {
+		return utils.InvalidCredentialsError()
+	}
 
-	if req.Password != dencryptedPassword {
-		return utils.NotFoundError("invalid password")
+	if err := h.repo.ResetLoginFailures(accountKey); err != nil {
+		return err
+	}
+	if err := h.repo.RefundLoginAttempt(ipKey, ipLimit.maxAttempts); err != nil {
+		return err
+	}
+
+	// upgrade legacy encrypted passwords and outdated hash parameters
+	if needsRehash {
+		hashedPassword, err := utils.HashPassword(req.Password)
+		if err != nil {
+			return err
+		}
+		if err := h.repo.UpdateUserPassword(user.Id, hashedPassword); err != nil {
+			return err
+		}
 	}
 
-	token, err := utils.CreateToken(user.Id)
+	// with two-factor authentication enabled the password alone only gets
+	// a challenge, to be exchanged at /login/2fa
+	totp, err := h.repo.GetTOTPByUserId(user.Id)
 	if err != nil {
 		return err
 	}
+	if totp != nil && totp.ConfirmedAt != nil {
+		challengeToken, err := utils.CreateChallengeToken(user.Id)
+		if err != nil {
+			return err
+		}
+		return utils.WriteJSON(w, http.StatusOK, map[string]any{
+			"twoFactorRequired": true,
+			"challengeToken":    challengeToken,
+		})
+	}
 
-	return utils.WriteJSON(w, http.StatusOK, map[string]any{
-		"token": token,
-		"user":  user,
-	})
+	tokens, err := issueTokens(h.repo, user.Id)
+	if err != nil {
+		return err
+	}
+
+	return writeSession(w, http.StatusOK, tokens, user)
 }
 
 func (h *UserHandler) HandleUpdateUserById(w http.ResponseWriter, r *http.Request) error {
@@ -138,14 +190,42 @@ func (h *UserHandler) HandleUpdateUserById(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
+	samePassword, _, err := utils.VerifyPassword(req.Password, user.Password)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+
+	oldEmail := user.Email
 	user.Name = req.Name
 	user.Email = req.Email
-	user.Password = req.Password
+	user.Password = hashedPassword
+	if req.Timezone != "" {
+		user.Timezone = req.Timezone
+	}
 
 	if err := h.repo.UpdateUser(user); err != nil {
 		return err
 	}
 
+	// the new address has to be verified again
+	if user.EmailVerifiedAt == nil && req.Email != oldEmail {
+		if err := sendVerificationEmail(h.repo, h.mailer, user); err != nil {
+			return err
+		}
+	}
+
+	// a password change logs the user out everywhere
+	if !samePassword {
+		if err := revokeAllSessions(h.repo, user.Id); err != nil {
+			return err
+		}
+	}
+
 	return utils.WriteJSON(w, http.StatusOK, &user)
 }
 
@@ -162,6 +242,10 @@ func (h *UserHandler) HandleDeleteUserById(w http.ResponseWriter, r *http.Reques
 		return utils.ForbiddenError()
 	}
 
+	if err := revokeAllSessions(h.repo, user.Id); err != nil {
+		return err
+	}
+
 	if err := h.repo.DeleteUserById(user.Id); err != nil {
 		return err
 	}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/assaidy/todo-api/filter"
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/repo"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type ViewHandler struct {
+	repo *repo.Repo
+}
+
+func NewViewHandler(r *repo.Repo) *ViewHandler {
+	return &ViewHandler{
+		repo: r,
+	}
+}
+
+// HandleGetAllViewsByUser lists the user's saved views. ?count=exact or
+// estimated counts the todos in each of them, for sidebar badges.
+func (h *ViewHandler) HandleGetAllViewsByUser(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	views, err := h.repo.GetSavedViewsByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	mode := r.URL.Query().Get("count")
+	if mode == "" {
+		mode = "none"
+	}
+	if mode != "none" {
+		// the user's time zone is needed to resolve dates in the filters
+		user, err := h.repo.GetUserById(userId)
+		if err != nil {
+			if utils.IsApiError(err, http.StatusNotFound) {
+				return utils.ForbiddenError()
+			}
+			return err
+		}
+
+		now := time.Now()
+		for _, view := range views {
+			expr, _, err := parseSavedView(view)
+			if err != nil {
+				return err
+			}
+			f := repo.TodoFilter{Expr: expr, Location: user.Location(), Now: now}
+			if view.Count, err = countTodos(h.repo, userId, f, mode); err != nil {
+				return err
+			}
+		}
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"data": views,
+	})
+}
+
+func (h *ViewHandler) HandleGetViewById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	viewId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	view, err := h.repo.GetSavedViewByIdAndUserId(viewId, userId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, view)
+}
+
+func (h *ViewHandler) HandleCreateView(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	req := models.SavedViewCreateOrUpdateRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := validateViewRequest(&req); err != nil {
+		return err
+	}
+
+	views, err := h.repo.GetSavedViewsByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	if exists, err := h.repo.CheckSavedViewNameExists(userId, req.Name); err != nil {
+		return err
+	} else if exists {
+		return utils.AlreadyExistsError(fmt.Sprintf("view '%s' already exists", req.Name))
+	}
+
+	view := models.SavedView{
+		UserId:   userId,
+		Name:     req.Name,
+		Filter:   req.Filter,
+		Sort:     req.Sort,
+		Position: len(views),
+	}
+	if req.Position != nil {
+		view.Position = *req.Position
+	}
+
+	if err := h.repo.InsertSavedView(&view); err != nil {
+		return err
+	}
+
+	return h.writeView(w, http.StatusCreated, view.Id, userId)
+}
+
+func (h *ViewHandler) HandleUpdateViewById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	viewId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	req := models.SavedViewCreateOrUpdateRequest{}
+	if err := utils.ParseJSON(r, &req); err != nil {
+		return err
+	}
+
+	if err := validateViewRequest(&req); err != nil {
+		return err
+	}
+
+	view, err := h.repo.GetSavedViewByIdAndUserId(viewId, userId)
+	if err != nil {
+		return err
+	}
+
+	if req.Name != view.Name {
+		if exists, err := h.repo.CheckSavedViewNameExists(userId, req.Name); err != nil {
+			return err
+		} else if exists {
+			return utils.AlreadyExistsError(fmt.Sprintf("view '%s' already exists", req.Name))
+		}
+	}
+
+	view.Name = req.Name
+	view.Filter = req.Filter
+	view.Sort = req.Sort
+	if req.Position != nil {
+		view.Position = *req.Position
+	}
+
+	if err := h.repo.UpdateSavedView(view); err != nil {
+		return err
+	}
+
+	return h.writeView(w, http.StatusOK, viewId, userId)
+}
+
+func (h *ViewHandler) HandleDeleteViewById(w http.ResponseWriter, r *http.Request) error {
+	userId, ok := utils.GetUserIdFromContext(r.Context())
+	if !ok {
+		return utils.ForbiddenError()
+	}
+
+	viewId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.repo.DeleteSavedView(viewId, userId); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// writeView writes the view as stored, its position may have been clamped
+// to the number of views.
+func (h *ViewHandler) writeView(w http.ResponseWriter, code int, viewId, userId int) error {
+	view, err := h.repo.GetSavedViewByIdAndUserId(viewId, userId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, code, view)
+}
+
+// validateViewRequest also checks the filter and sort would work on a todo
+// list, so a saved view never breaks when it's opened.
+func validateViewRequest(req *models.SavedViewCreateOrUpdateRequest) error {
+	if err := utils.Validate.Struct(req); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return utils.InvalidRequestData(validationErrors.Error())
+	}
+
+	expr, _, err := parseSavedView(&models.SavedView{Filter: req.Filter, Sort: req.Sort})
+	if err != nil {
+		return err
+	}
+
+	return repo.CheckTodoFilter(expr)
+}
+
+// parseSavedView parses the filter and sort of a view, both nil when empty.
+func parseSavedView(view *models.SavedView) (filter.Expr, []repo.TodoSortKey, error) {
+	var expr filter.Expr
+	if view.Filter != "" {
+		var err error
+		if expr, err = filter.Parse(view.Filter); err != nil {
+			return nil, nil, utils.InvalidRequestData(err.Error())
+		}
+	}
+
+	var sort []repo.TodoSortKey
+	if view.Sort != "" {
+		var err error
+		if sort, err = repo.ParseTodoSort(view.Sort); err != nil {
+			return nil, nil, utils.InvalidRequestData(err.Error())
+		}
+	}
+
+	return expr, sort, nil
+}
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/assaidy/todo-api/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers plain text emails. Send gives up once ctx is done.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by config.MailDriver.
+func New() (Mailer, error) {
+	switch config.MailDriver {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.MailFrom,
+		}, nil
+	case "file":
+		return &LogMailer{Path: config.MailFilePath}, nil
+	case "log":
+		return &LogMailer{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown mail driver %q", config.MailDriver)
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type Project struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"userId"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	Archived  bool      `json:"archived"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ProjectCreateOrUpdateRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Color    string `json:"color" validate:"omitempty,hexcolor"`
+	Archived bool   `json:"archived"`
+	// last for new projects and unchanged on update when omitted
+	Position *int `json:"position" validate:"omitempty,min=0"`
+}
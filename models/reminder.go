@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Reminder is a reminder the scheduler has claimed for delivery.
+type Reminder struct {
+	DeliveryId int        `json:"-"`
+	Attempts   int        `json:"-"` // failed attempts so far
+	TodoId     int        `json:"todoId"`
+	Title      string     `json:"title"`
+	DueAt      *time.Time `json:"dueAt"`
+	RemindAt   time.Time  `json:"remindAt"`
+	UserId     int        `json:"userId"`
+	UserName   string     `json:"-"`
+	UserEmail  string     `json:"-"`
+	Timezone   string     `json:"-"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type Status struct {
+	Id       int    `json:"id"`
+	UserId   int    `json:"userId"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	Position int    `json:"position"`
+	// todos in a terminal status are finished
+	Terminal bool `json:"terminal"`
+	// names of the statuses todos can move to from this one, nil if they can
+	// move to any
+	AllowedTransitions []string  `json:"allowedTransitions"`
+	CreatedAt          time.Time `json:"createdAt"`
+}
+
+type StatusCreateOrUpdateRequest struct {
+	Name  string `json:"name" validate:"required,max=50"`
+	Color string `json:"color" validate:"omitempty,hexcolor"`
+	// appended after the last status when omitted
+	Position *int `json:"position" validate:"omitempty,min=0"`
+	Terminal bool `json:"terminal"`
+	// null allows any transition, an empty list none
+	AllowedTransitions []string `json:"allowedTransitions" validate:"omitempty,dive,required,max=50"`
+}
@@ -3,18 +3,74 @@ package models
 import "time"
 
 type Todo struct {
-	Id          int       `json:"id"`
-	UserId      int       `json:"userId"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"createdAt"`
+	Id           int           `json:"id"`
+	UserId       int           `json:"userId"`
+	Title        string        `json:"title"`
+	Description  string        `json:"description"`
+	Status       string        `json:"status"`
+	Priority     int           `json:"priority"`
+	ProjectId    *int          `json:"projectId"` // nil for todos in the inbox
+	ParentId     *int          `json:"parentId"`  // nil for top level todos
+	AutoComplete bool          `json:"autoComplete"`
+	Progress     *TodoProgress `json:"progress"`
+	Tags         []string      `json:"tags"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	DueAt        *time.Time    `json:"dueAt"`
+	RemindAt     *time.Time    `json:"remindAt"`
+	// RFC 5545 RRULE, see utils.RRule
+	Recurrence      *string    `json:"recurrence"`
+	RecurrenceStart *time.Time `json:"-"`
+	Occurrence      int        `json:"occurrence"`
+	SeriesId        *int       `json:"-"`
+	Version         int        `json:"version"`
+	StatusPosition  int        `json:"-"` // for sorting by status
 }
 
+const DefaultTodoPriority = 2
+
 type TodoCreateOrUpdateRequest struct {
 	Title       string `json:"title" validate:"required"`
 	Description string `json:"description" validate:"required"`
-	Status      string `json:"status" validate:"required,oneof=todo doing done"`
+	// one of the user's statuses, checked against the database
+	Status string `json:"status" validate:"required,max=50"`
+	// 0 (P0, most urgent) to 3, DefaultTodoPriority for new todos and
+	// unchanged on update when omitted
+	Priority *int `json:"priority" validate:"omitempty,min=0,max=3"`
+	// one of the user's projects, the inbox if omitted
+	ProjectId *int `json:"projectId" validate:"omitempty,min=1"`
+	// makes the todo a subtask of another one of the user's todos
+	ParentId *int `json:"parentId" validate:"omitempty,min=1"`
+	// finish the todo once all its subtasks are finished
+	AutoComplete bool `json:"autoComplete"`
+	// reminders may be set without a due date, but never after it
+	DueAt    *time.Time `json:"dueAt"`
+	RemindAt *time.Time `json:"remindAt"`
+	// e.g. "FREQ=WEEKLY;BYDAY=MO,TH", needs a due date
+	Recurrence *string `json:"recurrence" validate:"omitempty,max=255"`
+}
+
+// TodoProgress counts the subtasks of a todo, nil for todos without any.
+type TodoProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// TodoSearchResult is a todo found by a full-text search.
+type TodoSearchResult struct {
+	Todo
+	Rank       float64        `json:"rank"`
+	Highlights TodoHighlights `json:"highlights"`
+}
+
+// TodoHighlights hold the title and snippets of the description with the
+// matched words wrapped in <mark> tags. They're safe HTML: everything else
+// is escaped.
+type TodoHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
 }
 
-// var TodoStatus = []string{"todo", "doing", "done"}
+type TodoOccurrence struct {
+	Occurrence int       `json:"occurrence"`
+	DueAt      time.Time `json:"dueAt"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+type RefreshToken struct {
+	Id        int
+	UserId    int
+	FamilyId  string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // access token lifetime in seconds
+}
+
+type TokenRefreshRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+	All          bool   `json:"all"` // log out of every session of the user
+}
+
+type PersonalAccessToken struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"userId"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"` // nil means it never expires
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type PersonalAccessTokenCreateRequest struct {
+	Name      string     `json:"name" validate:"required,max=255"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=todos:read todos:write"`
+	ExpiresAt *time.Time `json:"expiresAt" validate:"omitempty,gt"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type TOTP struct {
+	UserId       int
+	Secret       string // encrypted
+	CreatedAt    time.Time
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+type TwoFactorConfirmRequest struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// TwoFactorVerifyRequest takes either a code from the authenticator app or
+// one of the recovery codes.
+type TwoFactorVerifyRequest struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recoveryCode" validate:"required_without=Code"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	TwoFactorVerifyRequest
+}
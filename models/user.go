@@ -3,20 +3,43 @@ package models
 import "time"
 
 type User struct {
-	Id       int       `json:"id"`
-	Name     string    `json:"name"`
-	Email    string    `json:"email"`
-	Password string    `json:"-"`
-	JoinedAt time.Time `json:"joinedAt"`
+	Id              int        `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	JoinedAt        time.Time  `json:"joinedAt"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	Timezone        string     `json:"timezone"`
+}
+
+// Location returns the user's time zone, UTC if it's unknown.
+func (u *User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
 
 type UserCreateOrUpdateRequest struct {
 	Name     string `json:"name" validate:"required"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8,max=130"`
+	// IANA time zone name, e.g. Europe/Berlin. Defaults to UTC on register
+	// and stays unchanged on update when empty.
+	Timezone string `json:"timezone" validate:"omitempty,timezone"`
 }
 
 type UserLoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8,max=130"`
 }
+
+type PasswordForgotRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordResetRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=130"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// SavedView is a named todo list, e.g. "Due this week" with the filter
+// "due_at >= today and due_at <= today+6" sorted by "due_at".
+type SavedView struct {
+	Id       int    `json:"id"`
+	UserId   int    `json:"userId"`
+	Name     string `json:"name"`
+	Filter   string `json:"filter"`
+	Sort     string `json:"sort"`
+	Position int    `json:"position"`
+	// how many todos are in the view, only set when asked for
+	Count     *int      `json:"count,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type SavedViewCreateOrUpdateRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+	// the syntax of ?filter= and ?sort= of todo lists, checked by the handler
+	Filter string `json:"filter" validate:"max=2000"`
+	Sort   string `json:"sort" validate:"max=255"`
+	// last for new views and unchanged on update when omitted
+	Position *int `json:"position" validate:"omitempty,min=0"`
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/assaidy/todo-api/models"
 	"github.com/assaidy/todo-api/utils"
@@ -12,6 +14,8 @@ import (
 
 type Repo struct {
 	DB *sql.DB
+
+	revocations *revocationCache
 }
 
 func New(conn string) (*Repo, error) {
@@ -24,22 +28,33 @@ func New(conn string) (*Repo, error) {
 		return nil, err
 	}
 
-	return &Repo{DB: db}, nil
+	return &Repo{DB: db, revocations: newRevocationCache()}, nil
 }
 
+// InsertUser also creates the user's default statuses.
 func (r *Repo) InsertUser(user *models.User) error {
-	err := r.DB.QueryRow(QOInsertUser, user.Name, user.Email, user.Password).Scan(&user.Id)
+	tx, err := r.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	err = tx.QueryRow(QOInsertUser, user.Name, user.Email, user.Password, user.Timezone).Scan(&user.Id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(QEInsertDefaultStatuses, user.Id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *Repo) GetUserById(id int) (*models.User, error) {
 	user := &models.User{Id: id}
 
-	err := r.DB.QueryRow(QMGetUserById, id).Scan(&user.Name, &user.Email, &user.Password, &user.JoinedAt)
+	err := r.DB.QueryRow(QMGetUserById, id).Scan(&user.Name, &user.Email, &user.Password, &user.JoinedAt, &user.EmailVerifiedAt, &user.Timezone)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, utils.NotFoundError(fmt.Sprintf("no user with id %d found", id))
@@ -53,7 +68,7 @@ func (r *Repo) GetUserById(id int) (*models.User, error) {
 func (r *Repo) GetUserByEmail(email string) (*models.User, error) {
 	user := &models.User{Email: email}
 
-	err := r.DB.QueryRow(QMGetUserByEmail, email).Scan(&user.Id, &user.Name, &user.Password, &user.JoinedAt)
+	err := r.DB.QueryRow(QMGetUserByEmail, email).Scan(&user.Id, &user.Name, &user.Password, &user.JoinedAt, &user.EmailVerifiedAt, &user.Timezone)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, utils.NotFoundError(fmt.Sprintf("no user with email '%s' found", email))
@@ -65,7 +80,19 @@ func (r *Repo) GetUserByEmail(email string) (*models.User, error) {
 }
 
 func (r *Repo) UpdateUser(user *models.User) error {
-	res, err := r.DB.Exec(QEUpdateUser, user.Name, user.Email, user.Password, user.Id)
+	err := r.DB.QueryRow(QOUpdateUser, user.Name, user.Email, user.Password, user.Timezone, user.Id).Scan(&user.EmailVerifiedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundError(fmt.Sprintf("no user with id %d found", user.Id))
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repo) UpdateUserPassword(id int, password string) error {
+	res, err := r.DB.Exec(QEUpdateUserPassword, password, id)
 	if err != nil {
 		return err
 	}
@@ -75,7 +102,7 @@ func (r *Repo) UpdateUser(user *models.User) error {
 		return err
 	}
 	if affectedRows == 0 {
-		return utils.NotFoundError(fmt.Sprintf("no user with id %d found", user.Id))
+		return utils.NotFoundError(fmt.Sprintf("no user with id %d found", id))
 	}
 
 	return nil
@@ -122,47 +149,167 @@ func (r *Repo) CheckUserIdExists(id int) (bool, error) {
 	return true, nil
 }
 
+// InsertTodo checks the parent of a subtask in the same transaction, see checkTodoParent.
 func (r *Repo) InsertTodo(todo *models.Todo) error {
-	err := r.DB.QueryRow(QOInsertTodo, todo.UserId, todo.Title, todo.Description, todo.Status, todo.CreatedAt).Scan(&todo.Id)
+	tx, err := r.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
-}
+	if err := checkTodoParent(tx, todo.UserId, 0, todo.ParentId); err != nil {
+		return err
+	}
 
-func (r *Repo) UpdateTodo(todo *models.Todo) error {
-	res, err := r.DB.Exec(QEUpdateTodo, todo.Title, todo.Description, todo.Status, todo.Id, todo.UserId)
+	err = tx.QueryRow(QOInsertTodo, todoInsertArgs(todo)...).Scan(&todo.Id, &todo.Version)
 	if err != nil {
 		return err
 	}
 
-	affectedRows, err := res.RowsAffected()
+	return tx.Commit()
+}
+
+// insertTodoOccurrence inserts next, the next occurrence of the recurring
+// todo with id from, with a copy of its tags. Nothing happens if it already exists.
+func insertTodoOccurrence(tx *sql.Tx, next *models.Todo, from int) error {
+	err := tx.QueryRow(QOInsertTodoOccurrence, todoInsertArgs(next)...).Scan(&next.Id, &next.Version)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
 		return err
 	}
-	if affectedRows == 0 {
-		return utils.NotFoundError(fmt.Sprintf("no todo with id %d found", todo.Id))
+
+	if _, err := tx.Exec(QECopyTodoTags, from, next.Id); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (r *Repo) DeleteTodoByIdAndUserId(tid, uid int) error {
-	res, err := r.DB.Exec(QEDeleteTodo, tid, uid)
+func todoInsertArgs(todo *models.Todo) []any {
+	return []any{
+		todo.UserId,
+		todo.Title,
+		todo.Description,
+		todo.Status,
+		todo.Priority,
+		todo.ProjectId,
+		todo.ParentId,
+		todo.AutoComplete,
+		todo.CreatedAt,
+		todo.DueAt,
+		todo.RemindAt,
+		todo.Recurrence,
+		todo.RecurrenceStart,
+		todo.Occurrence,
+		todo.SeriesId,
+	}
+}
+
+// todoScanFields returns the scan destinations of the todo columns selected
+// by QOGetTodoByIdAndUser, QMListTodos and QMSearchTodos, in order.
+func todoScanFields(todo *models.Todo) []any {
+	return []any{
+		&todo.Id,
+		&todo.UserId,
+		&todo.Title,
+		&todo.Description,
+		&todo.Status,
+		&todo.Priority,
+		&todo.ProjectId,
+		&todo.ParentId,
+		&todo.AutoComplete,
+		&todo.CreatedAt,
+		&todo.DueAt,
+		&todo.RemindAt,
+		&todo.Recurrence,
+		&todo.RecurrenceStart,
+		&todo.Occurrence,
+		&todo.SeriesId,
+		&todo.Version,
+		&todo.StatusPosition,
+	}
+}
+
+// UpdateTodo only updates the todo if it's still at version, unless version is 0.
+// todo gets the new version. A new parent is checked in the same transaction,
+// see checkTodoParent, and next, unless it's nil, is inserted in it as the
+// todo's next occurrence.
+func (r *Repo) UpdateTodo(todo *models.Todo, version int, next *models.Todo) error {
+	tx, err := r.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	affectedRows, err := res.RowsAffected()
+	if err := checkTodoParent(tx, todo.UserId, todo.Id, todo.ParentId); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(QOUpdateTodo,
+		todo.Title,
+		todo.Description,
+		todo.Status,
+		todo.Priority,
+		todo.ProjectId,
+		todo.ParentId,
+		todo.AutoComplete,
+		todo.DueAt,
+		todo.RemindAt,
+		todo.Recurrence,
+		todo.RecurrenceStart,
+		todo.Occurrence,
+		todo.SeriesId,
+		todo.Id,
+		todo.UserId,
+		version,
+	).
+		Scan(&todo.CreatedAt, &todo.Version)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return r.todoNotUpdatedError(todo.Id, todo.UserId)
+		}
 		return err
 	}
-	if affectedRows == 0 {
+
+	if next != nil {
+		if err := insertTodoOccurrence(tx, next, todo.Id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTodoByIdAndUserId only deletes the todo if it's still at version, unless version is 0.
+// Its subtasks are deleted along with it. It returns the id of the todo's parent.
+func (r *Repo) DeleteTodoByIdAndUserId(tid, uid, version int) (*int, error) {
+	var parentId *int
+
+	err := r.DB.QueryRow(QODeleteTodo, tid, uid, version).Scan(&parentId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.todoNotUpdatedError(tid, uid)
+		}
+		return nil, err
+	}
+
+	return parentId, nil
+}
+
+// todoNotUpdatedError tells apart a missing todo from one that changed since
+// the version the caller expected.
+func (r *Repo) todoNotUpdatedError(tid, uid int) error {
+	owns, err := r.CheckUserOwnsTodo(tid, uid)
+	if err != nil {
+		return err
+	}
+	if !owns {
 		return utils.NotFoundError(fmt.Sprintf("no todo with id %d found for user with id %d", tid, uid))
 	}
 
-	return nil
+	return utils.PreconditionFailedError(fmt.Sprintf("todo with id %d has been modified", tid))
 }
 
 func (r *Repo) DeleteAllTodoByUserId(uid int) error {
@@ -182,69 +329,105 @@ func (r *Repo) DeleteAllTodoByUserId(uid int) error {
 	return nil
 }
 
-// NOTE: result is sorted by the creation date (most recent first)
-func (r *Repo) GetAllTodosByUserId(uid, limit, offset int) ([]*models.Todo, error) {
-	todos := []*models.Todo{}
+func (r *Repo) GetTodoByIdAndUserId(tid, uid int) (*models.Todo, error) {
+	todo := &models.Todo{}
 
-	rows, err := r.DB.Query(QMGetAllTodosByUserWithLimit, uid, limit, offset)
+	err := r.DB.QueryRow(QOGetTodoByIdAndUser, tid, uid).Scan(todoScanFields(todo)...)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		t := models.Todo{UserId: uid}
-		if err := rows.Scan(&t.Id, &t.Title, &t.Description, &t.Status, &t.CreatedAt); err != nil {
-			return nil, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.NotFoundError(fmt.Sprintf("no todo with id %d found for user with id %d", tid, uid))
 		}
-		todos = append(todos, &t)
+		return nil, err
 	}
 
-	if err := rows.Err(); err != nil {
+	if err := r.loadTodoDetails(todo); err != nil {
 		return nil, err
 	}
 
-	return todos, nil
+	return todo, nil
 }
 
-// NOTE: result is sorted by the creation date (most recent first)
-func (r *Repo) GetAllTodosByUserIdWithStatusFilter(uid, limit, offset int, status string) ([]*models.Todo, error) {
-	todos := []*models.Todo{}
-
-	rows, err := r.DB.Query(QMGetAllTodosByUserWithStatusFilter, uid, status, limit, offset)
+func (r *Repo) CheckUserOwnsTodo(tid, uid int) (bool, error) {
+	err := r.DB.QueryRow(QOCheckUserOwnTodo, tid, uid).Scan(new(int))
 	if err != nil {
-		return nil, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		t := models.Todo{UserId: uid}
-		if err := rows.Scan(&t.Id, &t.Title, &t.Description, &t.Status, &t.CreatedAt); err != nil {
-			return nil, err
+	return true, nil
+}
+
+// columns UpdateTodoColumns may set, so column names never come from user input
+var updatableTodoColumns = map[string]bool{
+	"title":            true,
+	"description":      true,
+	"status":           true,
+	"priority":         true,
+	"project_id":       true,
+	"parent_id":        true,
+	"auto_complete":    true,
+	"due_at":           true,
+	"remind_at":        true,
+	"rrule":            true,
+	"recurrence_start": true,
+	"occurrence":       true,
+	"series_id":        true,
+}
+
+// UpdateTodoColumns only sets the given columns of the todo, mapped to their
+// new values, if it's still at version, unless version is 0. It returns the new version.
+// A new parent_id, an *int, is checked in the same transaction, see checkTodoParent,
+// and next, unless it's nil, is inserted in it as the todo's next occurrence.
+func (r *Repo) UpdateTodoColumns(tid, uid, version int, changes map[string]any, next *models.Todo) (int, error) {
+	columns := make([]string, 0, len(changes))
+	for column := range changes {
+		if !updatableTodoColumns[column] {
+			return 0, fmt.Errorf("column %q of todos can't be updated", column)
 		}
-		todos = append(todos, &t)
+		columns = append(columns, column)
 	}
+	sort.Strings(columns)
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	sets := make([]string, 0, len(columns)+1)
+	args := make([]any, 0, len(columns)+3)
+	for i, column := range columns {
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, i+1))
+		args = append(args, changes[column])
 	}
+	sets = append(sets, "version = version + 1")
+	args = append(args, tid, uid, version)
 
-	return todos, nil
-}
+	n := len(columns)
+	query := fmt.Sprintf("UPDATE todos SET %s WHERE id = $%d AND user_id = $%d AND ($%d = 0 OR version = $%d) RETURNING version;",
+		strings.Join(sets, ", "), n+1, n+2, n+3, n+3)
 
-// func (pg *PostgresDB) CheckUserOwnsTodo(tid, uid int) (bool, error) {
-// 	query, err := sqlFiles.ReadFile("queries/todo_check_owner.sql")
-// 	if err != nil {
-// 		return false, err
-// 	}
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-// 	err = pg.DB.QueryRow(string(query), tid, uid).Scan(new(int))
-// 	if err != nil {
-// 		if errors.Is(err, sql.ErrNoRows) {
-// 			return false, nil
-// 		}
-// 		return false, err
-// 	}
+	if parentId, ok := changes["parent_id"].(*int); ok {
+		if err := checkTodoParent(tx, uid, tid, parentId); err != nil {
+			return 0, err
+		}
+	}
 
-// 	return true, nil
-// }
+	var newVersion int
+	if err := tx.QueryRow(query, args...).Scan(&newVersion); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, r.todoNotUpdatedError(tid, uid)
+		}
+		return 0, err
+	}
+
+	if next != nil {
+		if err := insertTodoOccurrence(tx, next, tid); err != nil {
+			return 0, err
+		}
+	}
+
+	return newVersion, tx.Commit()
+}
@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/assaidy/todo-api/utils"
+)
+
+func (r *Repo) InsertEmailVerification(uid int, email, hash string, expiresAt time.Time) error {
+	_, err := r.DB.Exec(QEInsertEmailVerification, uid, email, hash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// VerifyEmail consumes the verification token with the given hash and marks
+// the address it was sent to as verified, as long as the user still uses it.
+func (r *Repo) VerifyEmail(hash string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		uid   int
+		email string
+	)
+	if err := tx.QueryRow(QOConsumeEmailVerification, hash).Scan(&uid, &email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.InvalidRequestData("invalid or expired verification token")
+		}
+		return err
+	}
+
+	res, err := tx.Exec(QEMarkEmailVerified, uid, email)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return utils.InvalidRequestData("invalid or expired verification token")
+	}
+
+	return tx.Commit()
+}
+
+// GetEmailVerificationResendStats returns the time since the last verification
+// email was sent to the user (nil if none was) and how many were sent within the last hour.
+func (r *Repo) GetEmailVerificationResendStats(uid int) (*time.Duration, int, error) {
+	var (
+		seconds *int
+		count   int
+	)
+	if err := r.DB.QueryRow(QOGetEmailVerificationResendStats, uid).Scan(&seconds, &count); err != nil {
+		return nil, 0, err
+	}
+
+	if seconds == nil {
+		return nil, count, nil
+	}
+	sinceLast := time.Duration(*seconds) * time.Second
+	return &sinceLast, count, nil
+}
+
+// IsEmailVerified implements utils.TokenStore.
+func (r *Repo) IsEmailVerified(uid int) (bool, error) {
+	var verified bool
+	if err := r.DB.QueryRow(QOCheckEmailVerified, uid).Scan(&verified); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return verified, nil
+}
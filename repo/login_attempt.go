@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetLoginRetryAfter returns how long the longest block among keys lasts, 0 if none of them is blocked.
+func (r *Repo) GetLoginRetryAfter(keys ...string) (time.Duration, error) {
+	var seconds int
+	if err := r.DB.QueryRow(QOGetLoginRetryAfter, pq.Array(keys)).Scan(&seconds); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// RecordLoginAttempt counts an attempt for key, blocking it once it reaches
+// maxAttempts within window, see QORecordLoginAttempt. ok is false if the
+// key is blocked, the attempt isn't counted then.
+func (r *Repo) RecordLoginAttempt(key string, window time.Duration, maxAttempts int, lockout, maxLockout time.Duration) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(QEForgetOldLoginAttempts, key, window.Seconds()); err != nil {
+		return false, err
+	}
+
+	err = tx.QueryRow(QORecordLoginAttempt, key, maxAttempts, lockout.Seconds(), maxLockout.Seconds()).Scan(new(int))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// RefundLoginAttempt takes back a successful attempt counted for key.
+func (r *Repo) RefundLoginAttempt(key string, maxAttempts int) error {
+	_, err := r.DB.Exec(QERefundLoginAttempt, key, maxAttempts)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repo) ResetLoginFailures(key string) error {
+	_, err := r.DB.Exec(QEResetLoginFailures, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(64),
+    user_id INT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (jti)
+);
+
+-- every token of the user issued at or before revoked_before is rejected.
+-- no foreign key on purpose: the row has to outlive deleted users.
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id INT,
+    revoked_before TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_token_revocations;
+DROP TABLE revoked_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- failed logins per client ip ("ip:<addr>") and per account ("account:<email>").
+-- accounts are tracked by the submitted email, whether it exists or not.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(320),
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    blocked_until TIMESTAMP,
+    PRIMARY KEY (key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE login_attempts;
+-- +goose StatementEnd
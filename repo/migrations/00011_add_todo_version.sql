@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- bumped on every update, clients send it back in If-Match to detect lost updates
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN version;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS due_at TIMESTAMP;
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS remind_at TIMESTAMP;
+ALTER TABLE todos ADD CONSTRAINT todos_remind_before_due CHECK (remind_at IS NULL OR due_at IS NULL OR remind_at <= due_at);
+CREATE INDEX IF NOT EXISTS todos_user_id_due_at_idx ON todos (user_id, due_at);
+
+-- IANA name of the zone "today" and plain dates are resolved in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN timezone;
+DROP INDEX todos_user_id_due_at_idx;
+ALTER TABLE todos DROP CONSTRAINT todos_remind_before_due;
+ALTER TABLE todos DROP COLUMN remind_at;
+ALTER TABLE todos DROP COLUMN due_at;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- one row per reminder to fire. A delivery belongs to the remind_at it was
+-- created for, changing a todo's reminder creates a new one.
+-- next_attempt_at doubles as a lease: a scheduler that claims a delivery
+-- pushes it into the future so other replicas skip it while it's in flight.
+CREATE TABLE IF NOT EXISTS reminder_deliveries (
+    id SERIAL,
+    todo_id INT NOT NULL,
+    remind_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, delivered, failed, cancelled
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    delivered_at TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE (todo_id, remind_at),
+    FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS reminder_deliveries_pending_idx
+    ON reminder_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS reminder_delivery_attempts (
+    id SERIAL,
+    delivery_id INT NOT NULL,
+    attempted_at TIMESTAMP NOT NULL,
+    error TEXT, -- NULL if the attempt succeeded
+    PRIMARY KEY (id),
+    FOREIGN KEY (delivery_id) REFERENCES reminder_deliveries(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS todos_remind_at_idx ON todos (remind_at) WHERE remind_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX todos_remind_at_idx;
+DROP TABLE reminder_delivery_attempts;
+DROP TABLE reminder_deliveries;
+-- +goose StatementEnd
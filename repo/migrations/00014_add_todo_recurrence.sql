@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- rrule is an RFC 5545 RRULE, recurrence_start the due date of the series'
+-- first todo (DTSTART). Every occurrence is a todo of its own, series_id
+-- points at the first one (NULL for the first one itself) and occurrence is
+-- the position in the series, which makes generating the next one idempotent.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS rrule VARCHAR(255);
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS recurrence_start TIMESTAMP;
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS occurrence INT NOT NULL DEFAULT 1;
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS series_id INT REFERENCES todos(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS todos_series_occurrence_idx
+    ON todos (COALESCE(series_id, id), occurrence) WHERE rrule IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX todos_series_occurrence_idx;
+ALTER TABLE todos DROP COLUMN series_id;
+ALTER TABLE todos DROP COLUMN occurrence;
+ALTER TABLE todos DROP COLUMN recurrence_start;
+ALTER TABLE todos DROP COLUMN rrule;
+-- +goose StatementEnd
@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+-- statuses belong to a user. todos reference them by name through a
+-- composite key, so renaming a status renames it on every todo too.
+-- A todo in a terminal status is finished. If restrict_transitions is set,
+-- todos can only move to the statuses listed in status_transitions.
+CREATE TABLE IF NOT EXISTS statuses (
+    id SERIAL,
+    user_id INT NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    color VARCHAR(7) NOT NULL DEFAULT '',
+    position INT NOT NULL,
+    terminal BOOLEAN NOT NULL DEFAULT FALSE,
+    restrict_transitions BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (id),
+    UNIQUE (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS status_transitions (
+    from_status_id INT NOT NULL,
+    to_status_id INT NOT NULL,
+    PRIMARY KEY (from_status_id, to_status_id),
+    FOREIGN KEY (from_status_id) REFERENCES statuses(id) ON DELETE CASCADE,
+    FOREIGN KEY (to_status_id) REFERENCES statuses(id) ON DELETE CASCADE
+);
+
+-- every existing user gets the statuses that used to be global
+INSERT INTO statuses (user_id, name, position, terminal)
+SELECT u.id, s.name, s.position, s.terminal
+FROM users u
+CROSS JOIN (VALUES ('todo', 0, FALSE), ('doing', 1, FALSE), ('done', 2, TRUE)) AS s(name, position, terminal)
+ON CONFLICT (user_id, name) DO NOTHING;
+
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS todos_status_fkey;
+ALTER TABLE todos ADD CONSTRAINT todos_user_status_fkey
+    FOREIGN KEY (user_id, status) REFERENCES statuses(user_id, name) ON UPDATE CASCADE;
+
+DROP TABLE status;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS status (
+    name VARCHAR(50),
+    PRIMARY KEY (name)
+);
+
+INSERT INTO status (name) VALUES
+('todo'),
+('doing'),
+('done')
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE todos DROP CONSTRAINT todos_user_status_fkey;
+UPDATE todos SET status = NULL WHERE status NOT IN (SELECT name FROM status);
+ALTER TABLE todos ADD CONSTRAINT todos_status_fkey
+    FOREIGN KEY (status) REFERENCES status(name) ON DELETE SET NULL;
+
+DROP TABLE status_transitions;
+DROP TABLE statuses;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- 0 (P0) is the most urgent, 3 (P3) the least
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS priority SMALLINT NOT NULL DEFAULT 2 CHECK (priority BETWEEN 0 AND 3);
+CREATE INDEX IF NOT EXISTS todos_user_id_priority_idx ON todos (user_id, priority);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX todos_user_id_priority_idx;
+ALTER TABLE todos DROP COLUMN priority;
+-- +goose StatementEnd
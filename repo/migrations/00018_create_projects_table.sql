@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- projects group a user's todos, todos without one are in the inbox.
+-- Archived projects are kept, but no todos can be added to them.
+CREATE TABLE IF NOT EXISTS projects (
+    id SERIAL,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    color VARCHAR(7) NOT NULL DEFAULT '',
+    archived BOOLEAN NOT NULL DEFAULT FALSE,
+    position INT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (id),
+    UNIQUE (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE todos ADD COLUMN project_id INT REFERENCES projects(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS todos_user_id_project_id_idx ON todos (user_id, project_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS todos_user_id_project_id_idx;
+ALTER TABLE todos DROP COLUMN project_id;
+DROP TABLE projects;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- subtasks are deleted along with their parent. A parent with auto_complete
+-- set is finished as soon as all its subtasks are.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES todos(id) ON DELETE CASCADE;
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS auto_complete BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS todos_parent_id_idx ON todos (parent_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS todos_parent_id_idx;
+ALTER TABLE todos DROP COLUMN auto_complete;
+ALTER TABLE todos DROP COLUMN parent_id;
+-- +goose StatementEnd
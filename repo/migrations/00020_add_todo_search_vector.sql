@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- matches in the title rank higher than matches in the description
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS todos_search_vector_idx ON todos USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS todos_search_vector_idx;
+ALTER TABLE todos DROP COLUMN search_vector;
+-- +goose StatementEnd
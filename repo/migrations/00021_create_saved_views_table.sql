@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a saved view is a named todo list: a filter expression and a sort order,
+-- in the syntax of the ?filter= and ?sort= parameters of todo lists
+CREATE TABLE IF NOT EXISTS saved_views (
+    id SERIAL,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    filter TEXT NOT NULL DEFAULT '',
+    sort VARCHAR(255) NOT NULL DEFAULT '',
+    position INT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (id),
+    UNIQUE (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE saved_views;
+-- +goose StatementEnd
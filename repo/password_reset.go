@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/assaidy/todo-api/utils"
+)
+
+func (r *Repo) InsertPasswordReset(uid int, hash string, expiresAt time.Time) error {
+	_, err := r.DB.Exec(QEInsertPasswordReset, uid, hash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword consumes the reset token with the given hash and sets the
+// owner's password. Every other outstanding reset token of the user is
+// invalidated as well. It returns the id of the user.
+func (r *Repo) ResetPassword(hash, password string) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var uid int
+	if err := tx.QueryRow(QOConsumePasswordReset, hash).Scan(&uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, utils.InvalidRequestData("invalid or expired reset token")
+		}
+		return 0, err
+	}
+
+	if _, err := tx.Exec(QEExpirePasswordResetsByUser, uid); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(QEUpdateUserPassword, password, uid); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return uid, nil
+}
@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/utils"
+)
+
+// GetProjectsByUserId returns the user's projects ordered by position.
+func (r *Repo) GetProjectsByUserId(uid int) ([]*models.Project, error) {
+	rows, err := r.DB.Query(QMGetProjectsByUser, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []*models.Project{}
+	for rows.Next() {
+		p := models.Project{UserId: uid}
+		if err := rows.Scan(&p.Id, &p.Name, &p.Color, &p.Archived, &p.Position, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		projects = append(projects, &p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+func (r *Repo) GetProjectByIdAndUserId(id, uid int) (*models.Project, error) {
+	p := &models.Project{Id: id, UserId: uid}
+
+	err := r.DB.QueryRow(QOGetProjectByIdAndUser, id, uid).Scan(&p.Name, &p.Color, &p.Archived, &p.Position, &p.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.NotFoundError(fmt.Sprintf("no project with id %d found", id))
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (r *Repo) CheckProjectNameExists(uid int, name string) (bool, error) {
+	err := r.DB.QueryRow(QOCheckProjectNameExists, uid, name).Scan(new(int))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// InsertProject inserts the project at its position, the projects from
+// there on move one position down.
+func (r *Repo) InsertProject(p *models.Project) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(QOInsertProject, p.UserId, p.Name, p.Color, p.Archived, p.Position).Scan(&p.Id, &p.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := placeProject(tx, p.UserId, p.Id, p.Position); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repo) UpdateProject(p *models.Project) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(QEUpdateProject, p.Name, p.Color, p.Archived, p.Id, p.UserId)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return utils.NotFoundError(fmt.Sprintf("no project with id %d found", p.Id))
+	}
+
+	if err := placeProject(tx, p.UserId, p.Id, p.Position); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteProject deletes the project along with its todos if deleteTodos is
+// set, otherwise they're moved to the inbox.
+func (r *Repo) DeleteProject(id, uid int, deleteTodos bool) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := QEMoveProjectTodosToInbox
+	if deleteTodos {
+		query = QEDeleteProjectTodos
+	}
+	if _, err := tx.Exec(query, id, uid); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(QEDeleteProject, id, uid)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return utils.NotFoundError(fmt.Sprintf("no project with id %d found", id))
+	}
+
+	// close the gap the project left
+	if err := placeProject(tx, uid, 0, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func placeProject(tx *sql.Tx, uid, id, position int) error {
+	return place(tx, QMGetProjectPositionsForUpdate, QEUpdateProjectPosition, uid, id, position)
+}
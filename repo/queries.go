@@ -7,8 +7,8 @@ package repo
 // user ops
 const (
 	QOInsertUser = `
-    INSERT INTO users (name, email, password) 
-    VALUES ($1, $2, $3) 
+    INSERT INTO users (name, email, password, timezone) 
+    VALUES ($1, $2, $3, $4) 
     RETURNING id;`
 
 	QMGetUserById = `
@@ -16,7 +16,9 @@ const (
         name,
         email,
         password,
-        joined_at
+        joined_at,
+        email_verified_at,
+        timezone
     FROM users
     WHERE id = $1;`
 
@@ -25,17 +27,28 @@ const (
         id,
         name,
         password,
-        joined_at
+        joined_at,
+        email_verified_at,
+        timezone
     FROM users
     WHERE email = $1;`
 
-	QEUpdateUser = `
+	QOUpdateUser = `
+    -- changing the email address drops its verification
     UPDATE users 
     SET 
         name = $1,
         email = $2,
-        password = $3 
-    WHERE id = $4;`
+        password = $3,
+        timezone = $4,
+        email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END
+    WHERE id = $5
+    RETURNING email_verified_at;`
+
+	QEUpdateUserPassword = `
+    UPDATE users 
+    SET password = $1 
+    WHERE id = $2;`
 
 	QEDeleteUser = `
     DELETE FROM users 
@@ -57,70 +70,808 @@ const (
 // todo ops
 const (
 	QOInsertTodo = `
-    INSERT INTO todos (user_id, title, description, status, created_at)
-    VALUES ($1, $2, $3, $4, $5)
-    RETURNING id;`
+    INSERT INTO todos (user_id, title, description, status, priority, project_id, parent_id, auto_complete, created_at, due_at, remind_at, rrule, recurrence_start, occurrence, series_id)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+    RETURNING id, version;`
+
+	// does nothing if the occurrence already exists
+	QOInsertTodoOccurrence = `
+    INSERT INTO todos (user_id, title, description, status, priority, project_id, parent_id, auto_complete, created_at, due_at, remind_at, rrule, recurrence_start, occurrence, series_id)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+    ON CONFLICT DO NOTHING
+    RETURNING id, version;`
 
-	QMGetAllTodosByUser = `
+	// ListTodos appends the filters, order and pagination
+	QMListTodos = `
     SELECT
         id,
+        user_id,
         title,
         description,
         status,
-        created_at
+        priority,
+        project_id,
+        parent_id,
+        auto_complete,
+        created_at,
+        due_at,
+        remind_at,
+        rrule,
+        recurrence_start,
+        occurrence,
+        series_id,
+        version,
+        (SELECT s.position FROM statuses s WHERE s.user_id = todos.user_id AND s.name = todos.status) AS status_position
     FROM todos
-    WHERE user_id = $1
-    ORDER BY created_at DESC; -- newest first`
+    WHERE user_id = $1`
 
-	QMGetAllTodosByUserWithLimit = `
-    -- if limit is negative (-1) it will ignore the limitation 
-    -- and return all possible rows
-    SELECT
-        id,
-        title,
-        description,
-        status,
-        created_at
+	// CountTodos appends the filters
+	QOCountTodos = `
+    SELECT COUNT(*)
     FROM todos
-    WHERE user_id = $1
-    ORDER BY created_at DESC -- newest first
-    LIMIT $2
-    OFFSET $3;`
+    WHERE user_id = $1`
 
-	QMGetAllTodosByUserWithStatusFilter = `
-    -- if limit is negative (-1) it will ignore the limitation 
-    -- and return all possible rows
+	// SearchTodos appends the filters, order and pagination. Matched words are
+	// wrapped in chr(2) and chr(3) in the highlights, see highlightHTML.
+	QMSearchTodos = `
     SELECT
         id,
+        user_id,
         title,
         description,
         status,
-        created_at
-    FROM todos
-    WHERE user_id = $1 AND status = $2
-    ORDER BY created_at DESC -- newest first
-    LIMIT $3
-    OFFSET $4;`
+        priority,
+        project_id,
+        parent_id,
+        auto_complete,
+        created_at,
+        due_at,
+        remind_at,
+        rrule,
+        recurrence_start,
+        occurrence,
+        series_id,
+        version,
+        (SELECT s.position FROM statuses s WHERE s.user_id = todos.user_id AND s.name = todos.status) AS status_position,
+        ts_rank_cd(search_vector, query) AS rank,
+        ts_headline('english', title, query, 'HighlightAll=TRUE, StartSel="' || chr(2) || '", StopSel="' || chr(3) || '"'),
+        ts_headline('english', description, query, 'MaxFragments=2, MaxWords=20, MinWords=5, StartSel="' || chr(2) || '", StopSel="' || chr(3) || '"')
+    FROM todos, to_tsquery('english', $2) query
+    WHERE user_id = $1 AND search_vector @@ query`
 
-	QEUpdateTodo = `
+	// a version of 0 matches any version
+	QOUpdateTodo = `
     UPDATE todos
     SET 
         title = $1,
         description = $2,
-        status = $3
-    WHERE id = $4 AND user_id = $5;`
+        status = $3,
+        priority = $4,
+        project_id = $5,
+        parent_id = $6,
+        auto_complete = $7,
+        due_at = $8,
+        remind_at = $9,
+        rrule = $10,
+        recurrence_start = $11,
+        occurrence = $12,
+        series_id = $13,
+        version = version + 1
+    WHERE id = $14 AND user_id = $15 AND ($16 = 0 OR version = $16)
+    RETURNING created_at, version;`
 
-	QEDeleteTodo = `
+	// a version of 0 matches any version, subtasks are deleted by the foreign key
+	QODeleteTodo = `
     DELETE FROM todos
-    WHERE id = $1 AND user_id = $2;`
+    WHERE id = $1 AND user_id = $2 AND ($3 = 0 OR version = $3)
+    RETURNING parent_id;`
 
 	QEDeleteAllTodosByUser = `
     DELETE FROM todos
     WHERE user_id = $1;`
 
+	QOGetTodoByIdAndUser = `
+    SELECT
+        id,
+        user_id,
+        title,
+        description,
+        status,
+        priority,
+        project_id,
+        parent_id,
+        auto_complete,
+        created_at,
+        due_at,
+        remind_at,
+        rrule,
+        recurrence_start,
+        occurrence,
+        series_id,
+        version,
+        (SELECT s.position FROM statuses s WHERE s.user_id = todos.user_id AND s.name = todos.status) AS status_position
+    FROM todos
+    WHERE id = $1 AND user_id = $2;`
+
+	// nesting level of $1, 0 for top level todos, and whether $2 is $1 or one of its
+	// ancestors, looking at most $4 levels up so a cycle can't loop forever
+	QOGetTodoDepth = `
+    WITH RECURSIVE ancestors AS (
+        SELECT id, parent_id, 0 AS depth
+        FROM todos
+        WHERE id = $1 AND user_id = $3
+        UNION ALL
+        SELECT t.id, t.parent_id, a.depth + 1
+        FROM todos t
+        JOIN ancestors a ON t.id = a.parent_id
+        WHERE a.depth < $4
+    )
+    SELECT COALESCE(MAX(depth), 0), COALESCE(BOOL_OR(id = $2), FALSE)
+    FROM ancestors;`
+
+	// levels of subtasks below $1, counted up to $2
+	QOGetTodoHeight = `
+    WITH RECURSIVE descendants AS (
+        SELECT id, 0 AS depth
+        FROM todos
+        WHERE id = $1
+        UNION ALL
+        SELECT t.id, d.depth + 1
+        FROM todos t
+        JOIN descendants d ON t.parent_id = d.id
+        WHERE d.depth < $2
+    )
+    SELECT COALESCE(MAX(depth), 0)
+    FROM descendants;`
+
+	QOGetTodoParent = `
+    SELECT parent_id
+    FROM todos
+    WHERE id = $1 AND user_id = $2;`
+
+	// serializes the changes to the parents of the user's todos
+	QELockUserTodoTree = `
+    SELECT 1
+    FROM users
+    WHERE id = $1
+    FOR NO KEY UPDATE;`
+
+	QMGetTodoProgress = `
+    SELECT
+        c.parent_id,
+        COUNT(*),
+        COUNT(*) FILTER (WHERE s.terminal)
+    FROM todos c
+    JOIN statuses s ON s.user_id = c.user_id AND s.name = c.status
+    WHERE c.parent_id = ANY($1)
+    GROUP BY c.parent_id;`
+
+	QEBumpTodoVersion = `
+    UPDATE todos
+    SET version = version + 1
+    WHERE id = $1;`
+
 	QOCheckUserOwnTodo = `
     SELECT 1
-    FROM todo
+    FROM todos
     WHERE id = $1 AND user_id = $2
     LIMIT 1;`
 )
+
+// refresh token ops
+const (
+	QEInsertRefreshToken = `
+    INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+    VALUES ($1, $2, $3, $4);`
+
+	QOGetRefreshTokenByHashForUpdate = `
+    SELECT
+        id,
+        user_id,
+        family_id,
+        created_at,
+        expires_at,
+        used_at,
+        revoked_at
+    FROM refresh_tokens
+    WHERE token_hash = $1
+    FOR UPDATE;`
+
+	QEMarkRefreshTokenUsed = `
+    UPDATE refresh_tokens
+    SET used_at = NOW()
+    WHERE id = $1;`
+
+	QERevokeRefreshTokenFamily = `
+    UPDATE refresh_tokens
+    SET revoked_at = NOW()
+    WHERE family_id = $1 AND revoked_at IS NULL;`
+
+	QERevokeAllRefreshTokensByUser = `
+    UPDATE refresh_tokens
+    SET revoked_at = NOW()
+    WHERE user_id = $1 AND revoked_at IS NULL;`
+)
+
+// token revocation ops
+const (
+	QERevokeToken = `
+    INSERT INTO revoked_tokens (jti, user_id, expires_at)
+    VALUES ($1, $2, $3)
+    ON CONFLICT (jti) DO NOTHING;`
+
+	QOGetRevokedTokenExpiration = `
+    SELECT expires_at
+    FROM revoked_tokens
+    WHERE jti = $1;`
+
+	QEDeleteExpiredRevokedTokens = `
+    DELETE FROM revoked_tokens
+    WHERE expires_at < NOW();`
+
+	QERevokeAllTokensByUser = `
+    INSERT INTO user_token_revocations (user_id, revoked_before)
+    VALUES ($1, $2)
+    ON CONFLICT (user_id) DO UPDATE
+    SET revoked_before = GREATEST(user_token_revocations.revoked_before, EXCLUDED.revoked_before);`
+
+	QOGetUserTokenCutoff = `
+    SELECT revoked_before
+    FROM user_token_revocations
+    WHERE user_id = $1;`
+
+	QERevokeRefreshTokenFamilyByHash = `
+    UPDATE refresh_tokens
+    SET revoked_at = NOW()
+    WHERE revoked_at IS NULL AND family_id = (
+        SELECT family_id
+        FROM refresh_tokens
+        WHERE token_hash = $1 AND user_id = $2
+    );`
+)
+
+// personal access token ops
+const (
+	QOInsertPersonalAccessToken = `
+    INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, created_at, expires_at)
+    VALUES ($1, $2, $3, $4, $5, $6)
+    RETURNING id;`
+
+	QMGetAllPersonalAccessTokensByUser = `
+    SELECT
+        id,
+        name,
+        scopes,
+        created_at,
+        expires_at,
+        last_used_at
+    FROM personal_access_tokens
+    WHERE user_id = $1
+    ORDER BY created_at DESC;`
+
+	QEDeletePersonalAccessToken = `
+    DELETE FROM personal_access_tokens
+    WHERE id = $1 AND user_id = $2;`
+
+	QOUsePersonalAccessToken = `
+    UPDATE personal_access_tokens
+    SET last_used_at = NOW()
+    WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())
+    RETURNING user_id, scopes;`
+)
+
+// login attempt ops
+const (
+	QOGetLoginRetryAfter = `
+    -- seconds until every given key is unblocked, 0 if none is blocked
+    SELECT COALESCE(CEIL(EXTRACT(EPOCH FROM MAX(blocked_until) - NOW())), 0)::INT
+    FROM login_attempts
+    WHERE key = ANY($1) AND blocked_until > NOW();`
+
+	// attempts older than the window ($2 seconds) are forgotten
+	QEForgetOldLoginAttempts = `
+    UPDATE login_attempts
+    SET failures = 0
+    WHERE key = $1 AND last_failed_at < NOW() - make_interval(secs => $2);`
+
+	// counts an attempt for $1, unless it's blocked: then no row is returned.
+	// The attempt reaching the limit ($2) blocks the key for $3 seconds, every
+	// attempt after it doubles that, up to $4 seconds.
+	QORecordLoginAttempt = `
+    INSERT INTO login_attempts AS a (key, failures, last_failed_at, blocked_until)
+    VALUES ($1, 1, NOW(), CASE WHEN 1 >= $2 THEN NOW() + make_interval(secs => $3) END)
+    ON CONFLICT (key) DO UPDATE
+    SET 
+        failures = a.failures + 1,
+        last_failed_at = NOW(),
+        blocked_until = CASE
+            WHEN a.failures + 1 >= $2
+            THEN NOW() + make_interval(secs => LEAST($3 * POWER(2, LEAST(a.failures + 1 - $2, 30)), $4))
+        END
+    WHERE a.blocked_until IS NULL OR a.blocked_until <= NOW()
+    RETURNING failures;`
+
+	// takes back an attempt of $1 that succeeded, lifting the block it may
+	// have set when it was the one reaching the limit ($2)
+	QERefundLoginAttempt = `
+    UPDATE login_attempts
+    SET
+        failures = GREATEST(failures - 1, 0),
+        blocked_until = CASE WHEN failures - 1 < $2 THEN NULL ELSE blocked_until END
+    WHERE key = $1;`
+
+	QEResetLoginFailures = `
+    DELETE FROM login_attempts
+    WHERE key = $1;`
+)
+
+// password reset ops
+const (
+	QEInsertPasswordReset = `
+    INSERT INTO password_resets (user_id, token_hash, expires_at)
+    VALUES ($1, $2, $3);`
+
+	QOConsumePasswordReset = `
+    UPDATE password_resets
+    SET used_at = NOW()
+    WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+    RETURNING user_id;`
+
+	QEExpirePasswordResetsByUser = `
+    UPDATE password_resets
+    SET used_at = NOW()
+    WHERE user_id = $1 AND used_at IS NULL;`
+)
+
+// email verification ops
+const (
+	QEInsertEmailVerification = `
+    INSERT INTO email_verifications (user_id, email, token_hash, expires_at)
+    VALUES ($1, $2, $3, $4);`
+
+	QOConsumeEmailVerification = `
+    UPDATE email_verifications
+    SET used_at = NOW()
+    WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+    RETURNING user_id, email;`
+
+	QEMarkEmailVerified = `
+    UPDATE users
+    SET email_verified_at = NOW()
+    WHERE id = $1 AND email = $2;`
+
+	QOGetEmailVerificationResendStats = `
+    -- seconds since the last email (NULL if none) and emails sent within the last hour
+    SELECT
+        EXTRACT(EPOCH FROM NOW() - MAX(created_at))::INT,
+        COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '1 hour')
+    FROM email_verifications
+    WHERE user_id = $1;`
+
+	QOCheckEmailVerified = `
+    SELECT email_verified_at IS NOT NULL
+    FROM users
+    WHERE id = $1;`
+)
+
+// two-factor ops
+const (
+	QEUpsertTOTP = `
+    -- starting over an unconfirmed enrollment replaces its secret
+    INSERT INTO user_totp (user_id, secret)
+    VALUES ($1, $2)
+    ON CONFLICT (user_id) DO UPDATE
+    SET 
+        secret = EXCLUDED.secret,
+        created_at = NOW(),
+        last_used_step = 0
+    WHERE user_totp.confirmed_at IS NULL;`
+
+	QOGetTOTPByUser = `
+    SELECT
+        secret,
+        created_at,
+        confirmed_at,
+        last_used_step
+    FROM user_totp
+    WHERE user_id = $1;`
+
+	QEUseTOTPStep = `
+    UPDATE user_totp
+    SET last_used_step = $2
+    WHERE user_id = $1 AND last_used_step < $2;`
+
+	QEConfirmTOTP = `
+    UPDATE user_totp
+    SET confirmed_at = NOW()
+    WHERE user_id = $1;`
+
+	QEDeleteTOTP = `
+    DELETE FROM user_totp
+    WHERE user_id = $1;`
+
+	QEInsertRecoveryCode = `
+    INSERT INTO recovery_codes (user_id, code_hash)
+    VALUES ($1, $2);`
+
+	QEUseRecoveryCode = `
+    UPDATE recovery_codes
+    SET used_at = NOW()
+    WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;`
+
+	QEDeleteRecoveryCodesByUser = `
+    DELETE FROM recovery_codes
+    WHERE user_id = $1;`
+)
+
+// reminder delivery ops
+const (
+	QEEnqueueDueReminders = `
+    INSERT INTO reminder_deliveries (todo_id, remind_at, next_attempt_at)
+    SELECT id, remind_at, remind_at
+    FROM todos
+    WHERE remind_at <= $1 AND remind_at > $2 AND NOT EXISTS (
+        -- finished todos don't need reminding
+        SELECT 1 FROM statuses s
+        WHERE s.user_id = todos.user_id AND s.name = todos.status AND s.terminal
+    )
+    ON CONFLICT (todo_id, remind_at) DO NOTHING;`
+
+	// the reminder was changed or removed since the delivery was created
+	QECancelStaleReminderDeliveries = `
+    UPDATE reminder_deliveries d
+    SET status = 'cancelled'
+    WHERE d.status = 'pending' AND NOT EXISTS (
+        SELECT 1 FROM todos t WHERE t.id = d.todo_id AND t.remind_at = d.remind_at
+    );`
+
+	QMClaimReminderDeliveries = `
+    SELECT
+        d.id,
+        d.attempts,
+        t.id,
+        t.title,
+        t.due_at,
+        t.remind_at,
+        u.id,
+        u.name,
+        u.email,
+        u.timezone
+    FROM reminder_deliveries d
+    JOIN todos t ON t.id = d.todo_id AND t.remind_at = d.remind_at
+    JOIN users u ON u.id = t.user_id
+    WHERE d.status = 'pending' AND d.next_attempt_at <= $1
+    ORDER BY d.next_attempt_at
+    LIMIT $2
+    FOR UPDATE OF d SKIP LOCKED;`
+
+	QELeaseReminderDelivery = `
+    UPDATE reminder_deliveries
+    SET next_attempt_at = $1
+    WHERE id = $2;`
+
+	QEMarkReminderDelivered = `
+    UPDATE reminder_deliveries
+    SET
+        status = 'delivered',
+        attempts = attempts + 1,
+        delivered_at = $1,
+        last_error = NULL
+    WHERE id = $2;`
+
+	// status becomes failed once there are no attempts left
+	QEMarkReminderFailed = `
+    UPDATE reminder_deliveries
+    SET
+        status = CASE WHEN attempts + 1 >= $1 THEN 'failed' ELSE 'pending' END,
+        attempts = attempts + 1,
+        next_attempt_at = $2,
+        last_error = $3
+    WHERE id = $4;`
+
+	QEInsertReminderDeliveryAttempt = `
+    INSERT INTO reminder_delivery_attempts (delivery_id, attempted_at, error)
+    VALUES ($1, $2, $3);`
+)
+
+// status ops
+const (
+	// statuses every new user starts with
+	QEInsertDefaultStatuses = `
+    INSERT INTO statuses (user_id, name, position, terminal)
+    VALUES
+        ($1, 'todo', 0, FALSE),
+        ($1, 'doing', 1, FALSE),
+        ($1, 'done', 2, TRUE);`
+
+	QMGetStatusesByUser = `
+    SELECT
+        s.id,
+        s.name,
+        s.color,
+        s.position,
+        s.terminal,
+        s.restrict_transitions,
+        s.created_at,
+        COALESCE(array_agg(t.name ORDER BY t.position) FILTER (WHERE t.name IS NOT NULL), '{}')
+    FROM statuses s
+    LEFT JOIN status_transitions st ON st.from_status_id = s.id
+    LEFT JOIN statuses t ON t.id = st.to_status_id
+    WHERE s.user_id = $1
+    GROUP BY s.id
+    ORDER BY s.position, s.id;`
+
+	QOInsertStatus = `
+    INSERT INTO statuses (user_id, name, color, position, terminal, restrict_transitions)
+    VALUES ($1, $2, $3, $4, $5, $6)
+    RETURNING id, created_at;`
+
+	QEUpdateStatus = `
+    UPDATE statuses
+    SET
+        name = $1,
+        color = $2,
+        terminal = $3,
+        restrict_transitions = $4
+    WHERE id = $5 AND user_id = $6;`
+
+	QOGetStatusForUpdate = `
+    SELECT name, terminal
+    FROM statuses
+    WHERE id = $1 AND user_id = $2
+    FOR UPDATE;`
+
+	QEBumpTodosInStatus = `
+    UPDATE todos
+    SET version = version + 1
+    WHERE user_id = $1 AND status = $2;`
+
+	// the parents whose progress counts the todos in the status
+	QEBumpParentsOfTodosInStatus = `
+    UPDATE todos
+    SET version = version + 1
+    WHERE id IN (
+        SELECT parent_id
+        FROM todos
+        WHERE user_id = $1 AND status = $2 AND parent_id IS NOT NULL
+    );`
+
+	QMGetStatusPositionsForUpdate = `
+    SELECT id, position
+    FROM statuses
+    WHERE user_id = $1
+    ORDER BY position, id
+    FOR UPDATE;`
+
+	QEUpdateStatusPosition = `
+    UPDATE statuses
+    SET position = $1
+    WHERE id = $2 AND user_id = $3;`
+
+	QEDeleteStatusTransitionsFrom = `
+    DELETE FROM status_transitions
+    WHERE from_status_id = $1;`
+
+	QEInsertStatusTransitions = `
+    INSERT INTO status_transitions (from_status_id, to_status_id)
+    SELECT $1, id
+    FROM statuses
+    WHERE user_id = $2 AND name = ANY($3);`
+
+	QEMoveTodosToStatus = `
+    UPDATE todos
+    SET status = $1, version = version + 1
+    WHERE user_id = $2 AND status = $3;`
+
+	QOCountTodosInStatus = `
+    SELECT COUNT(*)
+    FROM todos
+    WHERE user_id = $1 AND status = $2;`
+
+	QEDeleteStatus = `
+    DELETE FROM statuses
+    WHERE id = $1 AND user_id = $2;`
+)
+
+// project ops
+const (
+	QOInsertProject = `
+    INSERT INTO projects (user_id, name, color, archived, position)
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING id, created_at;`
+
+	QMGetProjectsByUser = `
+    SELECT
+        id,
+        name,
+        color,
+        archived,
+        position,
+        created_at
+    FROM projects
+    WHERE user_id = $1
+    ORDER BY position, id;`
+
+	QOGetProjectByIdAndUser = `
+    SELECT
+        name,
+        color,
+        archived,
+        position,
+        created_at
+    FROM projects
+    WHERE id = $1 AND user_id = $2;`
+
+	QOCheckProjectNameExists = `
+    SELECT 1
+    FROM projects
+    WHERE user_id = $1 AND name = $2
+    LIMIT 1;`
+
+	QEUpdateProject = `
+    UPDATE projects
+    SET
+        name = $1,
+        color = $2,
+        archived = $3
+    WHERE id = $4 AND user_id = $5;`
+
+	QMGetProjectPositionsForUpdate = `
+    SELECT id, position
+    FROM projects
+    WHERE user_id = $1
+    ORDER BY position, id
+    FOR UPDATE;`
+
+	QEUpdateProjectPosition = `
+    UPDATE projects
+    SET position = $1
+    WHERE id = $2 AND user_id = $3;`
+
+	QEMoveProjectTodosToInbox = `
+    UPDATE todos
+    SET project_id = NULL, version = version + 1
+    WHERE project_id = $1 AND user_id = $2;`
+
+	QEDeleteProjectTodos = `
+    DELETE FROM todos
+    WHERE project_id = $1 AND user_id = $2;`
+
+	QEDeleteProject = `
+    DELETE FROM projects
+    WHERE id = $1 AND user_id = $2;`
+)
+
+// saved view ops
+const (
+	QOInsertSavedView = `
+    INSERT INTO saved_views (user_id, name, filter, sort, position)
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING id, created_at;`
+
+	QMGetSavedViewsByUser = `
+    SELECT
+        id,
+        name,
+        filter,
+        sort,
+        position,
+        created_at
+    FROM saved_views
+    WHERE user_id = $1
+    ORDER BY position, id;`
+
+	QOGetSavedViewByIdAndUser = `
+    SELECT
+        name,
+        filter,
+        sort,
+        position,
+        created_at
+    FROM saved_views
+    WHERE id = $1 AND user_id = $2;`
+
+	QOCheckSavedViewNameExists = `
+    SELECT 1
+    FROM saved_views
+    WHERE user_id = $1 AND name = $2
+    LIMIT 1;`
+
+	QEUpdateSavedView = `
+    UPDATE saved_views
+    SET
+        name = $1,
+        filter = $2,
+        sort = $3
+    WHERE id = $4 AND user_id = $5;`
+
+	QMGetSavedViewPositionsForUpdate = `
+    SELECT id, position
+    FROM saved_views
+    WHERE user_id = $1
+    ORDER BY position, id
+    FOR UPDATE;`
+
+	QEUpdateSavedViewPosition = `
+    UPDATE saved_views
+    SET position = $1
+    WHERE id = $2 AND user_id = $3;`
+
+	QEDeleteSavedView = `
+    DELETE FROM saved_views
+    WHERE id = $1 AND user_id = $2;`
+)
+
+// tag ops
+const (
+	QOInsertTag = `
+    INSERT INTO tags (user_id, name, color, created_at)
+    VALUES ($1, $2, $3, $4)
+    RETURNING id;`
+
+	QMGetTagsByUser = `
+    SELECT
+        id,
+        name,
+        color,
+        created_at
+    FROM tags
+    WHERE user_id = $1
+    ORDER BY name;`
+
+	QOGetTagByIdAndUser = `
+    SELECT
+        name,
+        color,
+        created_at
+    FROM tags
+    WHERE id = $1 AND user_id = $2;`
+
+	QOCheckTagNameExists = `
+    SELECT 1
+    FROM tags
+    WHERE user_id = $1 AND name = $2
+    LIMIT 1;`
+
+	QEUpdateTag = `
+    UPDATE tags
+    SET
+        name = $1,
+        color = $2
+    WHERE id = $3 AND user_id = $4;`
+
+	QEDeleteTag = `
+    DELETE FROM tags
+    WHERE id = $1 AND user_id = $2;`
+
+	// the tags are part of a todo's representation, so changing them changes its version
+	QEBumpTodosWithTag = `
+    UPDATE todos
+    SET version = version + 1
+    WHERE id IN (SELECT todo_id FROM todo_tags WHERE tag_id = $1);`
+
+	QEAttachTag = `
+    INSERT INTO todo_tags (todo_id, tag_id)
+    VALUES ($1, $2)
+    ON CONFLICT DO NOTHING;`
+
+	QEDetachTag = `
+    DELETE FROM todo_tags
+    WHERE todo_id = $1 AND tag_id = $2;`
+
+	QECopyTodoTags = `
+    INSERT INTO todo_tags (todo_id, tag_id)
+    SELECT $2, tag_id
+    FROM todo_tags
+    WHERE todo_id = $1
+    ON CONFLICT DO NOTHING;`
+
+	QMGetTagNamesByTodos = `
+    SELECT
+        tt.todo_id,
+        t.name
+    FROM todo_tags tt
+    JOIN tags t ON t.id = tt.tag_id
+    WHERE tt.todo_id = ANY($1)
+    ORDER BY t.name;`
+)
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/assaidy/todo-api/models"
+)
+
+// EnqueueDueReminders creates a pending delivery for every reminder that is
+// due at now, skipping ones older than maxDelay, and cancels pending
+// deliveries whose reminder was changed or removed since.
+func (r *Repo) EnqueueDueReminders(now time.Time, maxDelay time.Duration) error {
+	now = now.UTC()
+
+	if _, err := r.DB.Exec(QEEnqueueDueReminders, now, now.Add(-maxDelay)); err != nil {
+		return err
+	}
+
+	if _, err := r.DB.Exec(QECancelStaleReminderDeliveries); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimReminders locks up to limit pending deliveries that are due, skipping
+// the ones other schedulers hold, and leases them until now + lease so they
+// aren't claimed again while being delivered. A lease that runs out, because
+// the scheduler died for instance, makes the delivery due again.
+func (r *Repo) ClaimReminders(now time.Time, limit int, lease time.Duration) ([]*models.Reminder, error) {
+	now = now.UTC()
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(QMClaimReminderDeliveries, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	reminders := []*models.Reminder{}
+	for rows.Next() {
+		rem := models.Reminder{}
+		if err := rows.Scan(
+			&rem.DeliveryId,
+			&rem.Attempts,
+			&rem.TodoId,
+			&rem.Title,
+			&rem.DueAt,
+			&rem.RemindAt,
+			&rem.UserId,
+			&rem.UserName,
+			&rem.UserEmail,
+			&rem.Timezone,
+		); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		reminders = append(reminders, &rem)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, rem := range reminders {
+		if _, err := tx.Exec(QELeaseReminderDelivery, now.Add(lease), rem.DeliveryId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+func (r *Repo) MarkReminderDelivered(deliveryId int, at time.Time) error {
+	return r.recordReminderAttempt(deliveryId, at, nil, func(tx *sql.Tx) error {
+		_, err := tx.Exec(QEMarkReminderDelivered, at.UTC(), deliveryId)
+		return err
+	})
+}
+
+// MarkReminderFailed records a failed attempt and schedules the next one at
+// retryAt, the delivery is given up once maxAttempts are used.
+func (r *Repo) MarkReminderFailed(deliveryId int, at, retryAt time.Time, maxAttempts int, reason string) error {
+	return r.recordReminderAttempt(deliveryId, at, &reason, func(tx *sql.Tx) error {
+		_, err := tx.Exec(QEMarkReminderFailed, maxAttempts, retryAt.UTC(), reason, deliveryId)
+		return err
+	})
+}
+
+func (r *Repo) recordReminderAttempt(deliveryId int, at time.Time, reason *string, update func(tx *sql.Tx) error) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := update(tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(QEInsertReminderDeliveryAttempt, deliveryId, at.UTC(), reason); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/assaidy/todo-api/config"
+)
+
+// revocationCache keeps revocation lookups off the database for most requests.
+// Revoked tokens never become valid again, so positive results are kept until
+// the token expires. Negative results and per-user cutoffs are re-checked after
+// config.RevocationCacheSeconds so revocations made by other replicas are
+// picked up eventually.
+type revocationCache struct {
+	mu      sync.RWMutex
+	tokens  map[string]cachedRevocation
+	cutoffs map[int]cachedCutoff
+}
+
+type cachedRevocation struct {
+	revoked   bool
+	expiresAt time.Time // only set for revoked tokens
+	checkedAt time.Time
+}
+
+// above this size stale entries are swept before adding new ones
+const maxCachedRevocations = 10000
+
+type cachedCutoff struct {
+	cutoff    time.Time // zero if the user has no cutoff
+	checkedAt time.Time
+}
+
+func newRevocationCache() *revocationCache {
+	return &revocationCache{
+		tokens:  map[string]cachedRevocation{},
+		cutoffs: map[int]cachedCutoff{},
+	}
+}
+
+func (c *revocationCache) fresh(checkedAt time.Time) bool {
+	return time.Since(checkedAt) < time.Duration(config.RevocationCacheSeconds)*time.Second
+}
+
+func (c *revocationCache) storeToken(jti string, entry cachedRevocation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.tokens) >= maxCachedRevocations {
+		now := time.Now()
+		for k, v := range c.tokens {
+			if (v.revoked && now.After(v.expiresAt)) || (!v.revoked && !c.fresh(v.checkedAt)) {
+				delete(c.tokens, k)
+			}
+		}
+	}
+
+	c.tokens[jti] = entry
+}
+
+// RevokeToken revokes a single access token by its jti claim.
+func (r *Repo) RevokeToken(jti string, uid int, expiresAt time.Time) error {
+	if _, err := r.DB.Exec(QERevokeToken, jti, uid, expiresAt); err != nil {
+		return err
+	}
+
+	// piggyback cleanup of rows that can't match a valid token anymore
+	if _, err := r.DB.Exec(QEDeleteExpiredRevokedTokens); err != nil {
+		return err
+	}
+
+	r.revocations.storeToken(jti, cachedRevocation{revoked: true, expiresAt: expiresAt, checkedAt: time.Now()})
+
+	return nil
+}
+
+// RevokeAllTokensByUserId revokes every access token issued to the user so far.
+func (r *Repo) RevokeAllTokensByUserId(uid int) error {
+	cutoff := revocationCutoff(time.Now())
+
+	if _, err := r.DB.Exec(QERevokeAllTokensByUser, uid, cutoff); err != nil {
+		return err
+	}
+
+	r.revocations.mu.Lock()
+	r.revocations.cutoffs[uid] = cachedCutoff{cutoff: cutoff, checkedAt: time.Now()}
+	r.revocations.mu.Unlock()
+
+	return nil
+}
+
+// revocationCutoff returns the cutoff revoking the tokens issued before now.
+// Tokens carry their issue time in milliseconds, so one issued within the
+// same millisecond counts as issued after it: logging in right after a
+// password change must work.
+func revocationCutoff(now time.Time) time.Time {
+	return now.UTC().Truncate(time.Millisecond)
+}
+
+func (r *Repo) RevokeRefreshTokenFamilyByHash(uid int, hash string) error {
+	_, err := r.DB.Exec(QERevokeRefreshTokenFamilyByHash, hash, uid)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsTokenRevoked implements utils.TokenStore.
+func (r *Repo) IsTokenRevoked(jti string, uid int, issuedAt time.Time) (bool, error) {
+	cutoff, err := r.getUserTokenCutoff(uid)
+	if err != nil {
+		return false, err
+	}
+	if !cutoff.IsZero() && issuedAt.Before(cutoff) {
+		return true, nil
+	}
+
+	// tokens issued before the jti claim was introduced can only be
+	// revoked through the per-user cutoff
+	if jti == "" {
+		return false, nil
+	}
+
+	r.revocations.mu.RLock()
+	cached, ok := r.revocations.tokens[jti]
+	r.revocations.mu.RUnlock()
+	if ok && (cached.revoked || r.revocations.fresh(cached.checkedAt)) {
+		return cached.revoked, nil
+	}
+
+	entry := cachedRevocation{revoked: true, checkedAt: time.Now()}
+	if err := r.DB.QueryRow(QOGetRevokedTokenExpiration, jti).Scan(&entry.expiresAt); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+		entry.revoked = false
+	}
+	r.revocations.storeToken(jti, entry)
+
+	return entry.revoked, nil
+}
+
+func (r *Repo) getUserTokenCutoff(uid int) (time.Time, error) {
+	r.revocations.mu.RLock()
+	cached, ok := r.revocations.cutoffs[uid]
+	r.revocations.mu.RUnlock()
+	if ok && r.revocations.fresh(cached.checkedAt) {
+		return cached.cutoff, nil
+	}
+
+	var cutoff time.Time
+	if err := r.DB.QueryRow(QOGetUserTokenCutoff, uid).Scan(&cutoff); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, err
+		}
+	}
+
+	r.revocations.mu.Lock()
+	r.revocations.cutoffs[uid] = cachedCutoff{cutoff: cutoff, checkedAt: time.Now()}
+	r.revocations.mu.Unlock()
+
+	return cutoff, nil
+}
@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/assaidy/todo-api/utils"
+)
+
+// newCutoffRepo returns a repo whose cutoffs are only ever read from the
+// cache, so the tests don't need a database.
+func newCutoffRepo(uid int, cutoff time.Time) *Repo {
+	r := &Repo{revocations: newRevocationCache()}
+	r.revocations.cutoffs[uid] = cachedCutoff{cutoff: cutoff, checkedAt: time.Now().Add(time.Hour)}
+	return r
+}
+
+func issuedAt(t *testing.T, uid int) time.Time {
+	t.Helper()
+
+	token, err := utils.CreateToken(uid)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	_, info, err := utils.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken: %v", err)
+	}
+	return info.IssuedAt
+}
+
+func TestRevokeAllThenIssueImmediately(t *testing.T) {
+	const uid = 1
+
+	// many tries, so some land in the same millisecond and second as the cutoff
+	for i := 0; i < 200; i++ {
+		r := newCutoffRepo(uid, revocationCutoff(time.Now()))
+
+		revoked, err := r.IsTokenRevoked("", uid, issuedAt(t, uid))
+		if err != nil {
+			t.Fatalf("IsTokenRevoked: %v", err)
+		}
+		if revoked {
+			t.Fatalf("token issued right after revoking all tokens is revoked")
+		}
+	}
+}
+
+func TestRevokeAllRevokesEarlierTokens(t *testing.T) {
+	const uid = 1
+
+	before := issuedAt(t, uid)
+	time.Sleep(2 * time.Millisecond)
+	r := newCutoffRepo(uid, revocationCutoff(time.Now()))
+
+	revoked, err := r.IsTokenRevoked("", uid, before)
+	if err != nil {
+		t.Fatalf("IsTokenRevoked: %v", err)
+	}
+	if !revoked {
+		t.Fatalf("token issued before revoking all tokens isn't revoked")
+	}
+}
+
+func TestRevokeAllRevokesLegacyTokensOfTheSameSecond(t *testing.T) {
+	const uid = 1
+
+	// tokens without iat_ms only have the seconds of their issue time
+	cutoff := time.Date(2026, 1, 1, 12, 0, 0, 500*int(time.Millisecond), time.UTC)
+	r := newCutoffRepo(uid, revocationCutoff(cutoff))
+
+	revoked, err := r.IsTokenRevoked("", uid, cutoff.Truncate(time.Second))
+	if err != nil {
+		t.Fatalf("IsTokenRevoked: %v", err)
+	}
+	if !revoked {
+		t.Fatalf("legacy token issued in the second of the cutoff isn't revoked")
+	}
+}
@@ -0,0 +1,230 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/lib/pq"
+)
+
+// GetStatusesByUserId returns the user's statuses ordered by position.
+func (r *Repo) GetStatusesByUserId(uid int) ([]*models.Status, error) {
+	rows, err := r.DB.Query(QMGetStatusesByUser, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := []*models.Status{}
+	for rows.Next() {
+		var (
+			s           = models.Status{UserId: uid}
+			restrict    bool
+			transitions []string
+		)
+		if err := rows.Scan(&s.Id, &s.Name, &s.Color, &s.Position, &s.Terminal, &restrict, &s.CreatedAt, pq.Array(&transitions)); err != nil {
+			return nil, err
+		}
+		if restrict {
+			s.AllowedTransitions = append([]string{}, transitions...)
+		}
+		statuses = append(statuses, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// InsertStatus inserts the status at its position, the statuses from there
+// on move one position down.
+func (r *Repo) InsertStatus(s *models.Status) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(QOInsertStatus, s.UserId, s.Name, s.Color, s.Position, s.Terminal, s.AllowedTransitions != nil).
+		Scan(&s.Id, &s.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := setStatusTransitions(tx, s); err != nil {
+		return err
+	}
+
+	if err := placeStatus(tx, s.UserId, s.Id, s.Position); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStatus updates the status, renaming it renames it on the user's todos too.
+// The todos whose representation changes get a new version: the todos in a
+// renamed status, and the parents counting them when it becomes (or stops
+// being) terminal.
+func (r *Repo) UpdateStatus(s *models.Status) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		oldName     string
+		oldTerminal bool
+	)
+	if err := tx.QueryRow(QOGetStatusForUpdate, s.Id, s.UserId).Scan(&oldName, &oldTerminal); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.NotFoundError(fmt.Sprintf("no status with id %d found", s.Id))
+		}
+		return err
+	}
+
+	if _, err := tx.Exec(QEUpdateStatus, s.Name, s.Color, s.Terminal, s.AllowedTransitions != nil, s.Id, s.UserId); err != nil {
+		return err
+	}
+
+	if s.Name != oldName {
+		if _, err := tx.Exec(QEBumpTodosInStatus, s.UserId, s.Name); err != nil {
+			return err
+		}
+	}
+	if s.Terminal != oldTerminal {
+		if _, err := tx.Exec(QEBumpParentsOfTodosInStatus, s.UserId, s.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := setStatusTransitions(tx, s); err != nil {
+		return err
+	}
+
+	if err := placeStatus(tx, s.UserId, s.Id, s.Position); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteStatus deletes the status. Its todos are moved to replacement, if
+// it's empty the status must not be used by any todo.
+func (r *Repo) DeleteStatus(s *models.Status, replacement string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replacement != "" {
+		// the replacement may count differently in the progress of their parents
+		if _, err := tx.Exec(QEBumpParentsOfTodosInStatus, s.UserId, s.Name); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(QEMoveTodosToStatus, replacement, s.UserId, s.Name); err != nil {
+			return err
+		}
+	} else {
+		var count int
+		if err := tx.QueryRow(QOCountTodosInStatus, s.UserId, s.Name).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return utils.ConflictError(fmt.Sprintf("status '%s' is used by %d todos, pass a replacement status", s.Name, count))
+		}
+	}
+
+	res, err := tx.Exec(QEDeleteStatus, s.Id, s.UserId)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return utils.NotFoundError(fmt.Sprintf("no status with id %d found", s.Id))
+	}
+
+	// close the gap the status left
+	if err := placeStatus(tx, s.UserId, 0, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setStatusTransitions(tx *sql.Tx, s *models.Status) error {
+	if _, err := tx.Exec(QEDeleteStatusTransitionsFrom, s.Id); err != nil {
+		return err
+	}
+
+	if len(s.AllowedTransitions) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(QEInsertStatusTransitions, s.Id, s.UserId, pq.Array(s.AllowedTransitions))
+	return err
+}
+
+// placeStatus moves the status with the given id to position and numbers
+// the user's statuses from 0 on without gaps. An id of 0 only renumbers.
+func placeStatus(tx *sql.Tx, uid, id, position int) error {
+	return place(tx, QMGetStatusPositionsForUpdate, QEUpdateStatusPosition, uid, id, position)
+}
+
+// place moves the row with the given id to position and numbers the
+// user's rows from 0 on without gaps. positionsQuery selects and locks the
+// ids and positions of the user's rows in order, updateQuery sets the
+// position of one of them.
+func place(tx *sql.Tx, positionsQuery, updateQuery string, uid, id, position int) error {
+	rows, err := tx.Query(positionsQuery, uid)
+	if err != nil {
+		return err
+	}
+
+	var (
+		ids       []int
+		positions = map[int]int{}
+	)
+	for rows.Next() {
+		var rid, pos int
+		if err := rows.Scan(&rid, &pos); err != nil {
+			rows.Close()
+			return err
+		}
+		positions[rid] = pos
+		if rid != id {
+			ids = append(ids, rid)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, ok := positions[id]; ok {
+		position = min(max(position, 0), len(ids))
+		ids = append(ids[:position], append([]int{id}, ids[position:]...)...)
+	}
+
+	for i, rid := range ids {
+		if positions[rid] == i {
+			continue
+		}
+		if _, err := tx.Exec(updateQuery, i, rid, uid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/assaidy/todo-api/config"
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/lib/pq"
+)
+
+// checkTodoParent checks that the todo tid, 0 for new todos, may become a
+// subtask of parentId: the parent must be one of the user's todos, neither the
+// todo itself nor one of its subtasks, and nesting must stay within
+// config.TodoMaxDepth. The user's todo tree stays locked until tx ends, so
+// concurrent moves are checked one after the other and can't make a cycle.
+func checkTodoParent(tx *sql.Tx, uid, tid int, parentId *int) error {
+	if parentId == nil {
+		return nil
+	}
+
+	if _, err := tx.Exec(QELockUserTodoTree, uid); err != nil {
+		return err
+	}
+
+	if tid != 0 {
+		var current *int
+		if err := tx.QueryRow(QOGetTodoParent, tid, uid).Scan(&current); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				// the update reports the missing todo
+				return nil
+			}
+			return err
+		}
+		if current != nil && *current == *parentId {
+			return nil
+		}
+	}
+
+	if err := tx.QueryRow(QOCheckUserOwnTodo, *parentId, uid).Scan(new(int)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.InvalidRequestData(fmt.Sprintf("no todo with id %d found", *parentId))
+		}
+		return err
+	}
+
+	// one level more than allowed is enough to tell it's too deep
+	limit := config.TodoMaxDepth + 1
+
+	var (
+		depth      int
+		isAncestor bool
+	)
+	if err := tx.QueryRow(QOGetTodoDepth, *parentId, tid, uid, limit).Scan(&depth, &isAncestor); err != nil {
+		return err
+	}
+	if isAncestor {
+		return utils.InvalidRequestData("a todo can't be a subtask of itself or of one of its subtasks")
+	}
+
+	height := 0
+	if tid != 0 {
+		if err := tx.QueryRow(QOGetTodoHeight, tid, limit).Scan(&height); err != nil {
+			return err
+		}
+	}
+	if depth+1+height > config.TodoMaxDepth {
+		return utils.InvalidRequestData(fmt.Sprintf("subtasks can be nested at most %d levels deep", config.TodoMaxDepth))
+	}
+
+	return nil
+}
+
+// BumpTodoVersion changes the todo's version for changes made to it
+// through other todos, like the progress of its subtasks.
+func (r *Repo) BumpTodoVersion(tid int) error {
+	_, err := r.DB.Exec(QEBumpTodoVersion, tid)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// loadTodoDetails fills in what todos get from other rows than their own.
+func (r *Repo) loadTodoDetails(todos ...*models.Todo) error {
+	if err := r.loadTodoTags(todos...); err != nil {
+		return err
+	}
+
+	return r.loadTodoProgress(todos...)
+}
+
+// loadTodoProgress counts the finished subtasks of todos.
+func (r *Repo) loadTodoProgress(todos ...*models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	byId := make(map[int]*models.Todo, len(todos))
+	ids := make([]int64, len(todos))
+	for i, t := range todos {
+		t.Progress = nil
+		byId[t.Id] = t
+		ids[i] = int64(t.Id)
+	}
+
+	rows, err := r.DB.Query(QMGetTodoProgress, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			parentId int
+			progress models.TodoProgress
+		)
+		if err := rows.Scan(&parentId, &progress.Total, &progress.Done); err != nil {
+			return err
+		}
+		if t, ok := byId[parentId]; ok {
+			t.Progress = &progress
+		}
+	}
+
+	return rows.Err()
+}
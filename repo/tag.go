@@ -0,0 +1,202 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/lib/pq"
+)
+
+func (r *Repo) InsertTag(tag *models.Tag) error {
+	err := r.DB.QueryRow(QOInsertTag, tag.UserId, tag.Name, tag.Color, tag.CreatedAt).Scan(&tag.Id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NOTE: result is sorted by name
+func (r *Repo) GetTagsByUserId(uid int) ([]*models.Tag, error) {
+	rows, err := r.DB.Query(QMGetTagsByUser, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*models.Tag{}
+	for rows.Next() {
+		t := models.Tag{UserId: uid}
+		if err := rows.Scan(&t.Id, &t.Name, &t.Color, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (r *Repo) GetTagByIdAndUserId(id, uid int) (*models.Tag, error) {
+	tag := &models.Tag{Id: id, UserId: uid}
+
+	err := r.DB.QueryRow(QOGetTagByIdAndUser, id, uid).Scan(&tag.Name, &tag.Color, &tag.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.NotFoundError(fmt.Sprintf("no tag with id %d found", id))
+		}
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+func (r *Repo) CheckTagNameExists(uid int, name string) (bool, error) {
+	err := r.DB.QueryRow(QOCheckTagNameExists, uid, name).Scan(new(int))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UpdateTag also bumps the version of the todos carrying the tag, since its
+// name is part of their representation.
+func (r *Repo) UpdateTag(tag *models.Tag) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(QEUpdateTag, tag.Name, tag.Color, tag.Id, tag.UserId)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return utils.NotFoundError(fmt.Sprintf("no tag with id %d found", tag.Id))
+	}
+
+	if _, err := tx.Exec(QEBumpTodosWithTag, tag.Id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTag removes the tag from all todos, bumping their version.
+func (r *Repo) DeleteTag(id, uid int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(QEBumpTodosWithTag, id); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(QEDeleteTag, id, uid)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return utils.NotFoundError(fmt.Sprintf("no tag with id %d found", id))
+	}
+
+	return tx.Commit()
+}
+
+// AttachTag tags the todo, bumping its version if it wasn't tagged yet.
+// Both must belong to the same user, which the caller checks.
+func (r *Repo) AttachTag(todoId, tagId int) error {
+	return r.changeTodoTags(QEAttachTag, todoId, tagId)
+}
+
+// DetachTag untags the todo, bumping its version if it was tagged.
+func (r *Repo) DetachTag(todoId, tagId int) error {
+	return r.changeTodoTags(QEDetachTag, todoId, tagId)
+}
+
+func (r *Repo) changeTodoTags(query string, todoId, tagId int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(query, todoId, tagId)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		// nothing changed
+		return nil
+	}
+
+	if _, err := tx.Exec(QEBumpTodoVersion, todoId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadTodoTags fills in the tag names of todos.
+func (r *Repo) loadTodoTags(todos ...*models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	byId := make(map[int]*models.Todo, len(todos))
+	ids := make([]int64, len(todos))
+	for i, t := range todos {
+		t.Tags = []string{}
+		byId[t.Id] = t
+		ids[i] = int64(t.Id)
+	}
+
+	rows, err := r.DB.Query(QMGetTagNamesByTodos, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			todoId int
+			name   string
+		)
+		if err := rows.Scan(&todoId, &name); err != nil {
+			return err
+		}
+		if t, ok := byId[todoId]; ok {
+			t.Tags = append(t.Tags, name)
+		}
+	}
+
+	return rows.Err()
+}
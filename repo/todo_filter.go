@@ -0,0 +1,331 @@
+package repo
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/assaidy/todo-api/filter"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/lib/pq"
+)
+
+type todoFilterKind int
+
+const (
+	textFilter todoFilterKind = iota
+	intFilter
+	timeFilter
+	boolFilter
+	tagFilter
+)
+
+type todoFilterField struct {
+	column   string
+	kind     todoFilterKind
+	nullable bool
+}
+
+// fields filter expressions can use. Only these columns ever make it into
+// the compiled SQL, values are always passed as arguments.
+var todoFilterFields = map[string]todoFilterField{
+	"title":       {column: "title", kind: textFilter},
+	"description": {column: "description", kind: textFilter},
+	"status":      {column: "status", kind: textFilter},
+	"priority":    {column: "priority", kind: intFilter},
+	"project_id":  {column: "project_id", kind: intFilter, nullable: true},
+	"parent_id":   {column: "parent_id", kind: intFilter, nullable: true},
+	"created_at":  {column: "created_at", kind: timeFilter},
+	"due_at":      {column: "due_at", kind: timeFilter, nullable: true},
+	"remind_at":   {column: "remind_at", kind: timeFilter, nullable: true},
+	// whether the todo is in a terminal status
+	"done": {kind: boolFilter},
+	// the names of the todo's tags, "tag is null" matches untagged todos
+	"tag": {kind: tagFilter},
+}
+
+var todoFilterOps = map[todoFilterKind][]string{
+	textFilter: {filter.OpEq, filter.OpNe, filter.OpIn, filter.OpNotIn, filter.OpMatch, filter.OpNotMatch},
+	intFilter:  {filter.OpEq, filter.OpNe, filter.OpLt, filter.OpLe, filter.OpGt, filter.OpGe, filter.OpIn, filter.OpNotIn},
+	timeFilter: {filter.OpEq, filter.OpNe, filter.OpLt, filter.OpLe, filter.OpGt, filter.OpGe},
+	boolFilter: {filter.OpEq, filter.OpNe},
+	tagFilter:  {filter.OpEq, filter.OpNe, filter.OpIn, filter.OpNotIn, filter.OpMatch, filter.OpNotMatch, filter.OpIsNull, filter.OpIsNotNull},
+}
+
+const (
+	todoHasTag = `EXISTS (
+        SELECT 1 FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id
+        WHERE tt.todo_id = todos.id AND t.name %s)`
+	todoHasAnyTag = `EXISTS (SELECT 1 FROM todo_tags tt WHERE tt.todo_id = todos.id)`
+)
+
+// todoFilterCompiler compiles filter expressions into SQL conditions on
+// todos, appending their values to args. Dates are days in loc, relative
+// ones count from now.
+type todoFilterCompiler struct {
+	args []any
+	loc  *time.Location
+	now  time.Time
+}
+
+func newTodoFilterCompiler(args []any, loc *time.Location, now time.Time) *todoFilterCompiler {
+	if loc == nil {
+		loc = time.UTC
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return &todoFilterCompiler{args: args, loc: loc, now: now}
+}
+
+// CheckTodoFilter reports the errors e would fail to compile with, like
+// unknown fields or values of the wrong type, as invalid request data.
+func CheckTodoFilter(e filter.Expr) error {
+	if e == nil {
+		return nil
+	}
+	_, err := newTodoFilterCompiler(nil, nil, time.Time{}).compile(e)
+	return err
+}
+
+func (c *todoFilterCompiler) arg(v any) string {
+	c.args = append(c.args, v)
+	return fmt.Sprintf("$%d", len(c.args))
+}
+
+func (c *todoFilterCompiler) compile(e filter.Expr) (string, error) {
+	switch e := e.(type) {
+	case filter.And:
+		return c.compileBinary("AND", e.Left, e.Right)
+	case filter.Or:
+		return c.compileBinary("OR", e.Left, e.Right)
+	case filter.Not:
+		cond, err := c.compile(e.Expr)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + cond + ")", nil
+	case filter.Comparison:
+		return c.compileComparison(e)
+	}
+	return "", fmt.Errorf("unknown filter expression %T", e)
+}
+
+func (c *todoFilterCompiler) compileBinary(op string, left, right filter.Expr) (string, error) {
+	l, err := c.compile(left)
+	if err != nil {
+		return "", err
+	}
+	r, err := c.compile(right)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%s %s %s)", l, op, r), nil
+}
+
+// compileComparison compiles a comparison into a condition that's never
+// NULL, so negating it matches exactly the todos it doesn't.
+func (c *todoFilterCompiler) compileComparison(cmp filter.Comparison) (string, error) {
+	field, ok := todoFilterFields[cmp.Field]
+	if !ok {
+		return "", filterError(cmp, fmt.Sprintf("can't filter todos by '%s'", cmp.Field))
+	}
+
+	allowed := todoFilterOps[field.kind]
+	if field.nullable {
+		allowed = slices.Concat(allowed, []string{filter.OpIsNull, filter.OpIsNotNull})
+	}
+	if !slices.Contains(allowed, cmp.Op) {
+		return "", filterError(cmp, fmt.Sprintf("'%s' can't be used with %s", cmp.Op, cmp.Field))
+	}
+
+	switch cmp.Op {
+	case filter.OpIsNull, filter.OpIsNotNull:
+		cond := field.column + " IS NULL"
+		if field.kind == tagFilter {
+			cond = "NOT " + todoHasAnyTag
+		}
+		if cmp.Op == filter.OpIsNotNull {
+			return "NOT (" + cond + ")", nil
+		}
+		return cond, nil
+	}
+
+	negated := cmp.Op == filter.OpNe || cmp.Op == filter.OpNotIn || cmp.Op == filter.OpNotMatch
+
+	var (
+		cond string
+		err  error
+	)
+	switch field.kind {
+	case textFilter:
+		cond = c.compileText(field.column, cmp)
+	case intFilter:
+		cond, err = c.compileInt(field.column, cmp)
+	case timeFilter:
+		cond, err = c.compileTime(field.column, cmp)
+	case boolFilter:
+		cond, err = c.compileDone(cmp)
+	case tagFilter:
+		cond = c.compileTag(cmp)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// a NULL never equals nor differs from anything in SQL, here it differs
+	if field.nullable {
+		if negated {
+			return fmt.Sprintf("(%s IS NULL OR %s)", field.column, cond), nil
+		}
+		return fmt.Sprintf("(%s IS NOT NULL AND %s)", field.column, cond), nil
+	}
+	return cond, nil
+}
+
+func (c *todoFilterCompiler) compileText(column string, cmp filter.Comparison) string {
+	switch cmp.Op {
+	case filter.OpIn:
+		return fmt.Sprintf("%s = ANY(%s)", column, c.arg(pq.Array(cmp.Values)))
+	case filter.OpNotIn:
+		return fmt.Sprintf("NOT %s = ANY(%s)", column, c.arg(pq.Array(cmp.Values)))
+	case filter.OpMatch:
+		return fmt.Sprintf("%s ILIKE %s", column, c.arg(containsPattern(cmp.Values[0])))
+	case filter.OpNotMatch:
+		return fmt.Sprintf("%s NOT ILIKE %s", column, c.arg(containsPattern(cmp.Values[0])))
+	case filter.OpNe:
+		return fmt.Sprintf("%s <> %s", column, c.arg(cmp.Values[0]))
+	}
+	return fmt.Sprintf("%s = %s", column, c.arg(cmp.Values[0]))
+}
+
+func (c *todoFilterCompiler) compileInt(column string, cmp filter.Comparison) (string, error) {
+	values := make([]int64, len(cmp.Values))
+	for i, v := range cmp.Values {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return "", filterError(cmp, fmt.Sprintf("%s must be compared to numbers, got '%s'", cmp.Field, v))
+		}
+		values[i] = n
+	}
+
+	switch cmp.Op {
+	case filter.OpIn:
+		return fmt.Sprintf("%s = ANY(%s)", column, c.arg(pq.Array(values))), nil
+	case filter.OpNotIn:
+		return fmt.Sprintf("NOT %s = ANY(%s)", column, c.arg(pq.Array(values))), nil
+	case filter.OpNe:
+		return fmt.Sprintf("%s <> %s", column, c.arg(values[0])), nil
+	}
+	return fmt.Sprintf("%s %s %s", column, cmp.Op, c.arg(values[0])), nil
+}
+
+// compileTime compares to RFC 3339 timestamps, dates or relative dates
+// (today, tomorrow, yesterday, today+N and today-N days). A date stands for
+// the whole day: due_at = 2026-01-01 is any time that day, due_at > 2026-01-01
+// starts the next one.
+func (c *todoFilterCompiler) compileTime(column string, cmp filter.Comparison) (string, error) {
+	v := cmp.Values[0]
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		op := cmp.Op
+		if op == filter.OpNe {
+			op = "<>"
+		}
+		return fmt.Sprintf("%s %s %s", column, op, c.arg(t.UTC())), nil
+	}
+
+	day, ok := c.relativeDay(v)
+	if !ok {
+		var err error
+		day, err = time.ParseInLocation("2006-01-02", v, c.loc)
+		if err != nil {
+			return "", filterError(cmp, fmt.Sprintf("%s must be compared to a date (YYYY-MM-DD, today, today+N, ...) or an RFC 3339 timestamp, got '%s'", cmp.Field, v))
+		}
+	}
+	start := day.UTC()
+	end := day.AddDate(0, 0, 1).UTC()
+
+	switch cmp.Op {
+	case filter.OpEq:
+		return fmt.Sprintf("(%s >= %s AND %s < %s)", column, c.arg(start), column, c.arg(end)), nil
+	case filter.OpNe:
+		return fmt.Sprintf("(%s < %s OR %s >= %s)", column, c.arg(start), column, c.arg(end)), nil
+	case filter.OpLt:
+		return fmt.Sprintf("%s < %s", column, c.arg(start)), nil
+	case filter.OpLe:
+		return fmt.Sprintf("%s < %s", column, c.arg(end)), nil
+	case filter.OpGt:
+		return fmt.Sprintf("%s >= %s", column, c.arg(end)), nil
+	}
+	return fmt.Sprintf("%s >= %s", column, c.arg(start)), nil
+}
+
+// relativeDay returns the start of the day v stands for in loc, if it's
+// a relative date.
+func (c *todoFilterCompiler) relativeDay(v string) (time.Time, bool) {
+	y, m, d := c.now.In(c.loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, c.loc)
+
+	switch v {
+	case "today":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+
+	rest, ok := strings.CutPrefix(v, "today")
+	if !ok || len(rest) < 2 || (rest[0] != '+' && rest[0] != '-') {
+		return time.Time{}, false
+	}
+	days, err := strconv.Atoi(rest[1:])
+	if err != nil || days < 0 || days > 3660 {
+		return time.Time{}, false
+	}
+	if rest[0] == '-' {
+		days = -days
+	}
+	return today.AddDate(0, 0, days), true
+}
+
+func (c *todoFilterCompiler) compileDone(cmp filter.Comparison) (string, error) {
+	done, err := strconv.ParseBool(cmp.Values[0])
+	if err != nil {
+		return "", filterError(cmp, fmt.Sprintf("done must be compared to true or false, got '%s'", cmp.Values[0]))
+	}
+
+	if done == (cmp.Op == filter.OpEq) {
+		return todoIsFinished, nil
+	}
+	return "NOT " + todoIsFinished, nil
+}
+
+func (c *todoFilterCompiler) compileTag(cmp filter.Comparison) string {
+	switch cmp.Op {
+	case filter.OpIn:
+		return fmt.Sprintf(todoHasTag, "= ANY("+c.arg(pq.Array(cmp.Values))+")")
+	case filter.OpNotIn:
+		return "NOT " + fmt.Sprintf(todoHasTag, "= ANY("+c.arg(pq.Array(cmp.Values))+")")
+	case filter.OpMatch:
+		return fmt.Sprintf(todoHasTag, "ILIKE "+c.arg(containsPattern(cmp.Values[0])))
+	case filter.OpNotMatch:
+		return "NOT " + fmt.Sprintf(todoHasTag, "ILIKE "+c.arg(containsPattern(cmp.Values[0])))
+	case filter.OpNe:
+		return "NOT " + fmt.Sprintf(todoHasTag, "= "+c.arg(cmp.Values[0]))
+	}
+	return fmt.Sprintf(todoHasTag, "= "+c.arg(cmp.Values[0]))
+}
+
+// containsPattern returns the ILIKE pattern matching text containing s.
+func containsPattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+func filterError(cmp filter.Comparison, msg string) error {
+	return utils.InvalidRequestData(fmt.Sprintf("filter: %s at position %d", msg, cmp.Pos))
+}
@@ -0,0 +1,318 @@
+package repo
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assaidy/todo-api/filter"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/lib/pq"
+)
+
+var (
+	// 01:30 on 2026-03-11 in testFilterLoc, still the 10th in UTC
+	testFilterNow = time.Date(2026, 3, 10, 22, 30, 0, 0, time.UTC)
+	testFilterLoc = time.FixedZone("UTC+3", 3*60*60)
+)
+
+// localDay returns the UTC start of the given day in testFilterLoc.
+func localDay(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, testFilterLoc).UTC()
+}
+
+func compileTodoFilter(t *testing.T, expr string) (string, []any, error) {
+	t.Helper()
+
+	c := newTodoFilterCompiler(nil, testFilterLoc, testFilterNow)
+	cond, err := c.compile(mustParse(t, expr))
+	return cond, c.args, err
+}
+
+func TestCompileTodoFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		cond string
+		args []any
+	}{
+		{
+			expr: "title = report",
+			cond: "title = $1",
+			args: []any{"report"},
+		},
+		{
+			expr: "title != report",
+			cond: "title <> $1",
+			args: []any{"report"},
+		},
+		{
+			expr: `title ~ "50%_off"`,
+			cond: "title ILIKE $1",
+			args: []any{`%50\%\_off%`},
+		},
+		{
+			expr: "status in (todo, doing)",
+			cond: "status = ANY($1)",
+			args: []any{pq.Array([]string{"todo", "doing"})},
+		},
+		{
+			expr: "priority >= 2",
+			cond: "priority >= $1",
+			args: []any{int64(2)},
+		},
+		{
+			expr: "priority not in (1, 3)",
+			cond: "NOT priority = ANY($1)",
+			args: []any{pq.Array([]int64{1, 3})},
+		},
+		{
+			expr: "project_id = 7",
+			cond: "(project_id IS NOT NULL AND project_id = $1)",
+			args: []any{int64(7)},
+		},
+		{
+			expr: "project_id != 7",
+			cond: "(project_id IS NULL OR project_id <> $1)",
+			args: []any{int64(7)},
+		},
+		{
+			expr: "parent_id is null",
+			cond: "parent_id IS NULL",
+		},
+		{
+			expr: "due_at is not null",
+			cond: "NOT (due_at IS NULL)",
+		},
+		{
+			expr: "due_at < 2026-01-01T09:00:00+02:00",
+			cond: "(due_at IS NOT NULL AND due_at < $1)",
+			args: []any{time.Date(2026, 1, 1, 7, 0, 0, 0, time.UTC)},
+		},
+		{
+			expr: "created_at = 2026-01-01",
+			cond: "(created_at >= $1 AND created_at < $2)",
+			args: []any{localDay(2026, 1, 1), localDay(2026, 1, 2)},
+		},
+		{
+			expr: "created_at != 2026-01-01",
+			cond: "(created_at < $1 OR created_at >= $2)",
+			args: []any{localDay(2026, 1, 1), localDay(2026, 1, 2)},
+		},
+		{
+			expr: "created_at > 2026-01-01",
+			cond: "created_at >= $1",
+			args: []any{localDay(2026, 1, 2)},
+		},
+		{
+			expr: "created_at <= 2026-01-01",
+			cond: "created_at < $1",
+			args: []any{localDay(2026, 1, 2)},
+		},
+		{
+			expr: "due_at = today",
+			cond: "(due_at IS NOT NULL AND (due_at >= $1 AND due_at < $2))",
+			args: []any{localDay(2026, 3, 11), localDay(2026, 3, 12)},
+		},
+		{
+			expr: "due_at = tomorrow",
+			cond: "(due_at IS NOT NULL AND (due_at >= $1 AND due_at < $2))",
+			args: []any{localDay(2026, 3, 12), localDay(2026, 3, 13)},
+		},
+		{
+			expr: "due_at < yesterday",
+			cond: "(due_at IS NOT NULL AND due_at < $1)",
+			args: []any{localDay(2026, 3, 10)},
+		},
+		{
+			expr: "due_at <= today+7",
+			cond: "(due_at IS NOT NULL AND due_at < $1)",
+			args: []any{localDay(2026, 3, 19)},
+		},
+		{
+			expr: "remind_at >= today-30",
+			cond: "(remind_at IS NOT NULL AND remind_at >= $1)",
+			args: []any{localDay(2026, 2, 9)},
+		},
+		{
+			expr: "due_at = today+0",
+			cond: "(due_at IS NOT NULL AND (due_at >= $1 AND due_at < $2))",
+			args: []any{localDay(2026, 3, 11), localDay(2026, 3, 12)},
+		},
+		{
+			expr: "done = true",
+			cond: todoIsFinished,
+		},
+		{
+			expr: "done != true",
+			cond: "NOT " + todoIsFinished,
+		},
+		{
+			expr: "done = false",
+			cond: "NOT " + todoIsFinished,
+		},
+		{
+			expr: "tag = work",
+			cond: fmt.Sprintf(todoHasTag, "= $1"),
+			args: []any{"work"},
+		},
+		{
+			expr: "tag not in (work, home)",
+			cond: "NOT " + fmt.Sprintf(todoHasTag, "= ANY($1)"),
+			args: []any{pq.Array([]string{"work", "home"})},
+		},
+		{
+			expr: "tag is null",
+			cond: "NOT " + todoHasAnyTag,
+		},
+		{
+			expr: "priority = 1 or priority = 2 and not title = x",
+			cond: "(priority = $1 OR (priority = $2 AND NOT (title = $3)))",
+			args: []any{int64(1), int64(2), "x"},
+		},
+		{
+			expr: "(priority = 1 or priority = 2) and title = x",
+			cond: "((priority = $1 OR priority = $2) AND title = $3)",
+			args: []any{int64(1), int64(2), "x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cond, args, err := compileTodoFilter(t, tt.expr)
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			if cond != tt.cond {
+				t.Errorf("cond\n got %s\nwant %s", cond, tt.cond)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args\n got %#v\nwant %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestCompileTodoFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		msg  string
+	}{
+		{expr: "owner = 1", msg: "can't filter todos by 'owner' at position 0"},
+		{expr: "title = x and user_id = 1", msg: "can't filter todos by 'user_id' at position 14"},
+		{expr: "title < x", msg: "'<' can't be used with title"},
+		{expr: "title is null", msg: "'is null' can't be used with title"},
+		{expr: "priority ~ 1", msg: "'~' can't be used with priority"},
+		{expr: "due_at in (today)", msg: "'in' can't be used with due_at"},
+		{expr: "done < true", msg: "'<' can't be used with done"},
+		{expr: "priority = high", msg: "priority must be compared to numbers, got 'high'"},
+		{expr: "priority in (1, x)", msg: "priority must be compared to numbers, got 'x'"},
+		{expr: "priority = 1.5", msg: "priority must be compared to numbers"},
+		{expr: "project_id = 99999999999", msg: "project_id must be compared to numbers"},
+		{expr: "done = maybe", msg: "done must be compared to true or false, got 'maybe'"},
+		{expr: "due_at = soon", msg: "due_at must be compared to a date"},
+		{expr: "due_at = 2026-02-30", msg: "due_at must be compared to a date"},
+		{expr: "due_at = today+", msg: "due_at must be compared to a date"},
+		{expr: "due_at = today+x", msg: "due_at must be compared to a date"},
+		{expr: "due_at = today+-1", msg: "due_at must be compared to a date"},
+		{expr: "due_at = today+3661", msg: "due_at must be compared to a date"},
+		{expr: "due_at = today+1d", msg: "due_at must be compared to a date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, err := compileTodoFilter(t, tt.expr)
+			if !utils.IsApiError(err, http.StatusBadRequest) {
+				t.Fatalf("compile = %v, want an invalid request data error", err)
+			}
+			if !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("compile = %v, want it to contain %q", err, tt.msg)
+			}
+			if err := CheckTodoFilter(mustParse(t, tt.expr)); !utils.IsApiError(err, http.StatusBadRequest) {
+				t.Errorf("CheckTodoFilter = %v, want an invalid request data error", err)
+			}
+		})
+	}
+}
+
+// values must only ever reach the database as arguments, whatever field,
+// operator or quoting they come with.
+func TestCompileTodoFilterBindsValues(t *testing.T) {
+	values := []string{
+		`'; DROP TABLE todos; --`,
+		`x" OR 1=1 --`,
+		`$1`,
+		`) OR (TRUE`,
+		`\'; SELECT pg_sleep(10); --`,
+	}
+	placeholder := regexp.MustCompile(`\$(\d+)`)
+
+	for _, v := range values {
+		quoted := `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+		exprs := []string{
+			"title = " + quoted,
+			"description != " + quoted,
+			"status in (a, " + quoted + ")",
+			"title ~ " + quoted,
+			"title !~ " + quoted,
+			"tag = " + quoted,
+			"tag != " + quoted,
+			"tag in (" + quoted + ", b)",
+			"tag ~ " + quoted,
+			"not (tag !~ " + quoted + " or title = " + quoted + ")",
+		}
+
+		for _, expr := range exprs {
+			cond, args, err := compileTodoFilter(t, expr)
+			if err != nil {
+				t.Fatalf("compile(%q): %v", expr, err)
+			}
+			if v != "$1" && strings.Contains(cond, v) {
+				t.Errorf("compile(%q) = %s, the value made it into the SQL", expr, cond)
+			}
+			if strings.ContainsAny(cond, `'"`) {
+				t.Errorf("compile(%q) = %s, the SQL holds a quote", expr, cond)
+			}
+
+			seen := map[int]bool{}
+			for _, m := range placeholder.FindAllStringSubmatch(cond, -1) {
+				var n int
+				fmt.Sscan(m[1], &n)
+				if n < 1 || n > len(args) {
+					t.Errorf("compile(%q) = %s, $%d has no argument", expr, cond, n)
+				}
+				seen[n] = true
+			}
+			if len(seen) != len(args) {
+				t.Errorf("compile(%q) = %s, uses %d of %d arguments", expr, cond, len(seen), len(args))
+			}
+		}
+	}
+}
+
+func TestCompileTodoFilterAppendsToArgs(t *testing.T) {
+	c := newTodoFilterCompiler([]any{42, "x"}, testFilterLoc, testFilterNow)
+	cond, err := c.compile(mustParse(t, "title = a or priority = 1"))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if want := "(title = $3 OR priority = $4)"; cond != want {
+		t.Errorf("cond = %s, want %s", cond, want)
+	}
+	if want := []any{42, "x", "a", int64(1)}; !reflect.DeepEqual(c.args, want) {
+		t.Errorf("args = %#v, want %#v", c.args, want)
+	}
+}
+
+func mustParse(t *testing.T, expr string) filter.Expr {
+	t.Helper()
+
+	e, err := filter.Parse(expr)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expr, err)
+	}
+	return e
+}
@@ -0,0 +1,542 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/assaidy/todo-api/filter"
+	"github.com/assaidy/todo-api/models"
+	"github.com/lib/pq"
+)
+
+// sortable todo columns by the name clients use in ?sort=. Only these ever
+// make it into ORDER BY.
+var todoSortColumns = map[string]string{
+	"created_at": "created_at",
+	"due_at":     "due_at",
+	"remind_at":  "remind_at",
+	"priority":   "priority",
+	"title":      "title",
+	"status":     todoStatusPosition, // in the order the user gave the statuses
+}
+
+const todoStatusPosition = `(SELECT s.position FROM statuses s WHERE s.user_id = todos.user_id AND s.name = todos.status)`
+
+const maxTodoSortKeys = 5
+
+// TodoSortKey orders todos by a column, descending if Desc is set.
+type TodoSortKey struct {
+	Column string
+	Desc   bool
+}
+
+// DefaultTodoSort lists the newest todos first.
+var DefaultTodoSort = []TodoSortKey{{Column: "created_at", Desc: true}}
+
+// ParseTodoSort parses a comma separated list of sort keys, each prefixed
+// with "-" for descending order, e.g. "-priority,due_at,title".
+func ParseTodoSort(s string) ([]TodoSortKey, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultTodoSort, nil
+	}
+
+	var (
+		keys = []TodoSortKey{}
+		seen = map[string]bool{}
+	)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		key := TodoSortKey{Column: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+
+		if _, ok := todoSortColumns[key.Column]; !ok {
+			return nil, fmt.Errorf("can't sort todos by '%s'", key.Column)
+		}
+		if seen[key.Column] {
+			return nil, fmt.Errorf("todos are sorted by '%s' twice", key.Column)
+		}
+		seen[key.Column] = true
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) > maxTodoSortKeys {
+		return nil, fmt.Errorf("todos can be sorted by at most %d keys", maxTodoSortKeys)
+	}
+
+	return keys, nil
+}
+
+// todoOrderBy builds the ORDER BY clause for keys. Todos without a value come
+// last in either direction, the id breaks ties so pages are stable. reverse
+// turns the whole order around, for reading a list backwards.
+func todoOrderBy(keys []TodoSortKey, reverse bool) string {
+	if len(keys) == 0 {
+		keys = DefaultTodoSort
+	}
+
+	nulls := "NULLS LAST"
+	if reverse {
+		nulls = "NULLS FIRST"
+	}
+
+	terms := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		terms = append(terms, fmt.Sprintf("%s %s %s", todoSortColumns[key.Column], sortDirection(key.Desc != reverse), nulls))
+	}
+	terms = append(terms, "id "+sortDirection(keys[len(keys)-1].Desc != reverse))
+
+	return strings.Join(terms, ", ")
+}
+
+func sortDirection(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// FormatTodoSort formats keys the way ParseTodoSort reads them.
+func FormatTodoSort(keys []TodoSortKey) string {
+	if len(keys) == 0 {
+		keys = DefaultTodoSort
+	}
+
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		fields[i] = key.Column
+		if key.Desc {
+			fields[i] = "-" + key.Column
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// TodoCursor is a position in a list of todos sorted by Sort, right at the
+// todo with id Id whose sort keys have the given values, nil for NULL. Pages
+// start after it, or end right before it if Before is set. If End is set
+// it's past the last todo instead.
+type TodoCursor struct {
+	Sort   string    `json:"s"`
+	Values []*string `json:"v,omitempty"`
+	Id     int       `json:"id,omitempty"`
+	Before bool      `json:"b,omitempty"`
+	End    bool      `json:"e,omitempty"`
+}
+
+// NewTodoCursor returns the cursor at todo in a list sorted by keys.
+func NewTodoCursor(todo *models.Todo, keys []TodoSortKey, before bool) *TodoCursor {
+	if len(keys) == 0 {
+		keys = DefaultTodoSort
+	}
+
+	c := &TodoCursor{
+		Sort:   FormatTodoSort(keys),
+		Values: make([]*string, len(keys)),
+		Id:     todo.Id,
+		Before: before,
+	}
+	for i, key := range keys {
+		c.Values[i] = todoSortValue(todo, key.Column)
+	}
+	return c
+}
+
+// NewTodoEndCursor returns the cursor past the last todo in a list sorted by
+// keys, the page before it is the last one.
+func NewTodoEndCursor(keys []TodoSortKey) *TodoCursor {
+	return &TodoCursor{Sort: FormatTodoSort(keys), Before: true, End: true}
+}
+
+// todoSortValue returns the value of a sort column of todo the way Postgres
+// reads it back as a parameter.
+func todoSortValue(todo *models.Todo, column string) *string {
+	var v string
+	switch column {
+	case "created_at":
+		v = todo.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "due_at", "remind_at":
+		t := todo.DueAt
+		if column == "remind_at" {
+			t = todo.RemindAt
+		}
+		if t == nil {
+			return nil
+		}
+		v = t.UTC().Format(time.RFC3339Nano)
+	case "priority":
+		v = strconv.Itoa(todo.Priority)
+	case "title":
+		v = todo.Title
+	case "status":
+		v = strconv.Itoa(todo.StatusPosition)
+	}
+	return &v
+}
+
+// writeCondition appends the condition selecting the todos past c, in the
+// direction it points to, in a list sorted by keys. It returns args with
+// its arguments added.
+func (c *TodoCursor) writeCondition(query *strings.Builder, keys []TodoSortKey, args []any) []any {
+	if len(keys) == 0 {
+		keys = DefaultTodoSort
+	}
+
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// lexicographic order: past the cursor in the first key that differs,
+	// built from the id, the last key, outwards
+	op := func(desc bool) string {
+		if desc != c.Before {
+			return "<"
+		}
+		return ">"
+	}
+	cond := fmt.Sprintf("id %s %s", op(keys[len(keys)-1].Desc), arg(c.Id))
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		column := todoSortColumns[keys[i].Column]
+		value := c.Values[i]
+
+		var past, equal string
+		if value == nil {
+			// NULLs come last in both directions
+			equal = column + " IS NULL"
+			if c.Before {
+				past = column + " IS NOT NULL"
+			}
+		} else {
+			v := arg(*value)
+			equal = fmt.Sprintf("%s = %s", column, v)
+			past = fmt.Sprintf("%s %s %s", column, op(keys[i].Desc), v)
+			if !c.Before {
+				past = fmt.Sprintf("(%s OR %s IS NULL)", past, column)
+			}
+		}
+
+		if past == "" {
+			cond = fmt.Sprintf("(%s AND %s)", equal, cond)
+		} else {
+			cond = fmt.Sprintf("(%s OR (%s AND %s))", past, equal, cond)
+		}
+	}
+
+	query.WriteString(" AND " + cond)
+	return args
+}
+
+// todoIsFinished is true for todos in a terminal status
+const todoIsFinished = `EXISTS (
+        SELECT 1 FROM statuses s
+        WHERE s.user_id = todos.user_id AND s.name = todos.status AND s.terminal
+    )`
+
+// TodoFilter narrows down the todos ListTodos returns. Zero values don't filter.
+type TodoFilter struct {
+	// Expr is a filter expression on the fields in todoFilterFields, its
+	// dates are days in Location, UTC if it's nil, and relative dates like
+	// today+7 count from Now, the current time if it's zero
+	Expr     filter.Expr
+	Location *time.Location
+	Now      time.Time
+	// ProjectId filters the todos of a project, or of the inbox if it's 0
+	ProjectId *int
+	// ParentId filters the subtasks of a todo, or top level todos if it's 0
+	ParentId *int
+	// due_at in [DueAfter, DueBefore)
+	DueAfter  *time.Time
+	DueBefore *time.Time
+	// HasDueDate filters todos with (true) or without (false) a due date
+	HasDueDate *bool
+	// OverdueAt filters todos that are due before it and not done yet
+	OverdueAt *time.Time
+	// Tags filters todos carrying any (or, with TagMode "all", every one) of them
+	Tags    []string
+	TagMode string
+	// Search filters todos matching a tsquery text search, see utils.ParseSearchQuery
+	Search string
+	Sort   []TodoSortKey
+}
+
+// Tag modes of TodoFilter.
+const (
+	TagModeAny = "any"
+	TagModeAll = "all"
+)
+
+// writeConditions appends the conditions of f to a query of the user's todos
+// and returns args with their arguments added. Invalid filter expressions
+// are reported as invalid request data.
+func (f TodoFilter) writeConditions(query *strings.Builder, args []any) ([]any, error) {
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		fmt.Fprintf(query, " AND "+cond, len(args))
+	}
+
+	if f.Search != "" {
+		where("search_vector @@ to_tsquery('english', $%d)", f.Search)
+	}
+	if f.Expr != nil {
+		c := newTodoFilterCompiler(args, f.Location, f.Now)
+		cond, err := c.compile(f.Expr)
+		if err != nil {
+			return nil, err
+		}
+		args = c.args
+		query.WriteString(" AND " + cond)
+	}
+	if f.ProjectId != nil {
+		if *f.ProjectId == 0 {
+			query.WriteString(" AND project_id IS NULL")
+		} else {
+			where("project_id = $%d", *f.ProjectId)
+		}
+	}
+	if f.ParentId != nil {
+		if *f.ParentId == 0 {
+			query.WriteString(" AND parent_id IS NULL")
+		} else {
+			where("parent_id = $%d", *f.ParentId)
+		}
+	}
+	if f.DueAfter != nil {
+		where("due_at >= $%d", f.DueAfter.UTC())
+	}
+	if f.DueBefore != nil {
+		where("due_at < $%d", f.DueBefore.UTC())
+	}
+	if f.HasDueDate != nil {
+		if *f.HasDueDate {
+			query.WriteString(" AND due_at IS NOT NULL")
+		} else {
+			query.WriteString(" AND due_at IS NULL")
+		}
+	}
+	if f.OverdueAt != nil {
+		where("due_at < $%d AND NOT "+todoIsFinished, f.OverdueAt.UTC())
+	}
+
+	if len(f.Tags) > 0 {
+		tags := slices.Compact(slices.Sorted(slices.Values(f.Tags)))
+		if f.TagMode == TagModeAll {
+			where(fmt.Sprintf("(SELECT COUNT(DISTINCT t.name)%s) = %d", todoTagNames, len(tags)), pq.Array(tags))
+		} else {
+			where("EXISTS (SELECT 1"+todoTagNames+")", pq.Array(tags))
+		}
+	}
+
+	return args, nil
+}
+
+// todoTagNames selects the names of the tags of a todo
+const todoTagNames = `
+        FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id
+        WHERE tt.todo_id = todos.id AND t.name = ANY($%d)`
+
+// ListTodos returns a page of the user's todos matching f.
+// NOTE: result is sorted by the creation date (most recent first) unless f.Sort says otherwise
+func (r *Repo) ListTodos(uid int, f TodoFilter, limit, offset int) ([]*models.Todo, error) {
+	var (
+		query = strings.Builder{}
+		args  = []any{uid}
+	)
+	query.WriteString(QMListTodos)
+
+	args, err := f.writeConditions(&query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&query, " ORDER BY %s LIMIT $%d OFFSET $%d;", todoOrderBy(f.Sort, false), len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	return r.queryTodos(query.String(), args)
+}
+
+// ListTodosAt returns up to limit of the user's todos matching f that come
+// after c, or before it if c.Before is set, in the order of f.Sort. A nil
+// cursor starts at the beginning of the list. Either way the todos are in
+// list order. c must have been made for f.Sort.
+func (r *Repo) ListTodosAt(uid int, f TodoFilter, c *TodoCursor, limit int) ([]*models.Todo, error) {
+	var (
+		query   = strings.Builder{}
+		args    = []any{uid}
+		reverse = c != nil && c.Before
+	)
+	query.WriteString(QMListTodos)
+
+	args, err := f.writeConditions(&query, args)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil && !c.End {
+		args = c.writeCondition(&query, f.Sort, args)
+	}
+
+	// pages before the cursor are read backwards from it
+	fmt.Fprintf(&query, " ORDER BY %s LIMIT $%d;", todoOrderBy(f.Sort, reverse), len(args)+1)
+	args = append(args, limit)
+
+	todos, err := r.queryTodos(query.String(), args)
+	if err != nil {
+		return nil, err
+	}
+
+	if reverse {
+		slices.Reverse(todos)
+	}
+
+	return todos, nil
+}
+
+func (r *Repo) queryTodos(query string, args []any) ([]*models.Todo, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []*models.Todo{}
+	for rows.Next() {
+		t := models.Todo{}
+		if err := rows.Scan(todoScanFields(&t)...); err != nil {
+			return nil, err
+		}
+		todos = append(todos, &t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadTodoDetails(todos...); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// CountTodos returns how many of the user's todos match f.
+func (r *Repo) CountTodos(uid int, f TodoFilter) (int, error) {
+	var (
+		query = strings.Builder{}
+		args  = []any{uid}
+	)
+	query.WriteString(QOCountTodos)
+
+	args, err := f.writeConditions(&query, args)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	if err := r.DB.QueryRow(query.String(), args...).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// EstimateTodos returns the planner's estimate of how many of the user's
+// todos match f. It doesn't read the todos, but can be far off.
+func (r *Repo) EstimateTodos(uid int, f TodoFilter) (int, error) {
+	var (
+		query = strings.Builder{}
+		args  = []any{uid}
+	)
+	query.WriteString("EXPLAIN (FORMAT JSON) " + QMListTodos)
+
+	args, err := f.writeConditions(&query, args)
+	if err != nil {
+		return 0, err
+	}
+
+	var plan []byte
+	if err := r.DB.QueryRow(query.String(), args...).Scan(&plan); err != nil {
+		return 0, err
+	}
+
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return 0, err
+	}
+	if len(explained) == 0 {
+		return 0, fmt.Errorf("no plan to estimate todos from")
+	}
+
+	return int(explained[0].Plan.Rows), nil
+}
+
+// SearchTodos returns a page of the user's todos matching f, which needs
+// a Search. Todos matching it best come first unless f.Sort says otherwise.
+func (r *Repo) SearchTodos(uid int, f TodoFilter, limit, offset int) ([]*models.TodoSearchResult, error) {
+	var (
+		query = strings.Builder{}
+		args  = []any{uid, f.Search}
+	)
+	query.WriteString(QMSearchTodos)
+
+	// QMSearchTodos already matches the search
+	f.Search = ""
+
+	args, err := f.writeConditions(&query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	orderBy := "rank DESC, id DESC"
+	if len(f.Sort) > 0 {
+		orderBy = todoOrderBy(f.Sort, false)
+	}
+	fmt.Fprintf(&query, " ORDER BY %s LIMIT $%d OFFSET $%d;", orderBy, len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.DB.Query(query.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		results = []*models.TodoSearchResult{}
+		todos   = []*models.Todo{}
+	)
+	for rows.Next() {
+		res := models.TodoSearchResult{}
+		fields := append(todoScanFields(&res.Todo), &res.Rank, &res.Highlights.Title, &res.Highlights.Description)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, err
+		}
+		res.Highlights.Title = highlightHTML(res.Highlights.Title)
+		res.Highlights.Description = highlightHTML(res.Highlights.Description)
+		results = append(results, &res)
+		todos = append(todos, &res.Todo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadTodoDetails(todos...); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// highlightHTML escapes a ts_headline of QMSearchTodos and wraps its matches
+// in <mark> tags, so the todo's own text is never taken as HTML.
+func highlightHTML(headline string) string {
+	return strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(html.EscapeString(headline))
+}
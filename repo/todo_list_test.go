@@ -0,0 +1,301 @@
+package repo
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assaidy/todo-api/models"
+)
+
+func TestTodoCursorWriteCondition(t *testing.T) {
+	due := "2026-01-02T00:00:00Z"
+	tests := []struct {
+		name   string
+		keys   []TodoSortKey
+		cursor TodoCursor
+		cond   string
+		args   []any
+	}{
+		{
+			name:   "after, descending",
+			keys:   []TodoSortKey{{Column: "priority", Desc: true}},
+			cursor: TodoCursor{Values: []*string{ptr("2")}, Id: 7},
+			cond:   " AND ((priority < $3 OR priority IS NULL) OR (priority = $3 AND id < $2))",
+			args:   []any{1, 7, "2"},
+		},
+		{
+			name:   "before, ascending",
+			keys:   []TodoSortKey{{Column: "priority"}},
+			cursor: TodoCursor{Values: []*string{ptr("2")}, Id: 7, Before: true},
+			cond:   " AND (priority < $3 OR (priority = $3 AND id < $2))",
+			args:   []any{1, 7, "2"},
+		},
+		{
+			name:   "after a NULL",
+			keys:   []TodoSortKey{{Column: "due_at", Desc: true}, {Column: "title"}},
+			cursor: TodoCursor{Values: []*string{nil, ptr("a")}, Id: 7},
+			cond:   " AND (due_at IS NULL AND ((title > $3 OR title IS NULL) OR (title = $3 AND id > $2)))",
+			args:   []any{1, 7, "a"},
+		},
+		{
+			name:   "before a NULL",
+			keys:   []TodoSortKey{{Column: "due_at"}, {Column: "title", Desc: true}},
+			cursor: TodoCursor{Values: []*string{nil, &due}, Id: 7, Before: true},
+			cond:   " AND (due_at IS NOT NULL OR (due_at IS NULL AND (title > $3 OR (title = $3 AND id > $2))))",
+			args:   []any{1, 7, due},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query strings.Builder
+			args := tt.cursor.writeCondition(&query, tt.keys, []any{1})
+			if query.String() != tt.cond {
+				t.Errorf("cond\n got %s\nwant %s", query.String(), tt.cond)
+			}
+			if fmt.Sprint(args) != fmt.Sprint(tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+// the condition of a cursor at any todo of a sorted list has to select
+// exactly the todos after it, or before it, in the order todoOrderBy sorts
+// them, whichever keys are ascending or descending and whichever values
+// are NULL.
+func TestTodoCursorWriteConditionSelectsThePage(t *testing.T) {
+	base := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	todos := make([]*models.Todo, 36)
+	for i := range todos {
+		todo := &models.Todo{
+			Id:             i + 1,
+			Title:          string(rune('a' + i%3)),
+			Priority:       i % 4,
+			StatusPosition: i % 2,
+			CreatedAt:      base.Add(time.Duration(i%6) * time.Hour),
+		}
+		if i%4 != 0 {
+			dueAt := base.AddDate(0, 0, i%5)
+			todo.DueAt = &dueAt
+		}
+		if i%3 != 0 {
+			remindAt := base.Add(time.Duration(i%2) * time.Minute)
+			todo.RemindAt = &remindAt
+		}
+		todos[i] = todo
+	}
+
+	sorts := []string{
+		"-created_at",
+		"due_at",
+		"-due_at",
+		"remind_at,-due_at",
+		"-priority,due_at",
+		"due_at,-remind_at,title",
+		"-due_at,title,-priority",
+		"status,-remind_at",
+		"-title,remind_at,-status,due_at",
+	}
+
+	for _, sort := range sorts {
+		t.Run(sort, func(t *testing.T) {
+			keys, err := ParseTodoSort(sort)
+			if err != nil {
+				t.Fatalf("ParseTodoSort: %v", err)
+			}
+			list := slices.Clone(todos)
+			slices.SortFunc(list, func(a, b *models.Todo) int { return compareTodos(a, b, keys) })
+
+			for i, at := range list {
+				for _, before := range []bool{false, true} {
+					c := NewTodoCursor(at, keys, before)
+					var query strings.Builder
+					args := c.writeCondition(&query, keys, nil)
+					cond := strings.TrimPrefix(query.String(), " AND ")
+
+					var want []int
+					for j, todo := range list {
+						if (before && j < i) || (!before && j > i) {
+							want = append(want, todo.Id)
+						}
+					}
+					var got []int
+					for _, todo := range list {
+						if evalCursorCondition(t, cond, args, todo) {
+							got = append(got, todo.Id)
+						}
+					}
+
+					if !slices.Equal(got, want) {
+						t.Fatalf("cursor at todo %d (before %v): %s\n got %v\nwant %v", at.Id, before, cond, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// compareTodos orders todos by keys the way todoOrderBy does: NULLs last in
+// either direction and ties broken by id, in the direction of the last key.
+func compareTodos(a, b *models.Todo, keys []TodoSortKey) int {
+	for _, key := range keys {
+		va, vb := todoSortValue(a, key.Column), todoSortValue(b, key.Column)
+		switch {
+		case va == nil && vb == nil:
+			continue
+		case va == nil:
+			return 1
+		case vb == nil:
+			return -1
+		}
+		if c := compareSortValues(key.Column, *va, *vb); c != 0 {
+			if key.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	c := a.Id - b.Id
+	if keys[len(keys)-1].Desc {
+		return -c
+	}
+	return c
+}
+
+func compareSortValues(column, a, b string) int {
+	switch column {
+	case "priority", "status", "id":
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return x - y
+	case "created_at", "due_at", "remind_at":
+		x, _ := time.Parse(time.RFC3339Nano, a)
+		y, _ := time.Parse(time.RFC3339Nano, b)
+		return x.Compare(y)
+	}
+	return strings.Compare(a, b)
+}
+
+// evalCursorCondition evaluates a condition made by writeCondition for todo,
+// the way Postgres would. It understands only the SQL writeCondition writes.
+func evalCursorCondition(t *testing.T, cond string, args []any, todo *models.Todo) bool {
+	t.Helper()
+
+	cond = strings.ReplaceAll(cond, todoStatusPosition, "status")
+	cond = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(cond)
+	e := &cursorConditionEval{tokens: strings.Fields(cond), args: args, todo: todo}
+
+	v := e.or()
+	if e.err == nil && len(e.tokens) > 0 {
+		e.err = fmt.Errorf("unexpected %q", e.tokens[0])
+	}
+	if e.err != nil {
+		t.Fatalf("can't evaluate %s: %v", cond, e.err)
+	}
+	return v
+}
+
+type cursorConditionEval struct {
+	tokens []string
+	args   []any
+	todo   *models.Todo
+	err    error
+}
+
+func (e *cursorConditionEval) next() string {
+	if len(e.tokens) == 0 {
+		if e.err == nil {
+			e.err = fmt.Errorf("unexpected end")
+		}
+		return ""
+	}
+	tok := e.tokens[0]
+	e.tokens = e.tokens[1:]
+	return tok
+}
+
+func (e *cursorConditionEval) or() bool {
+	v := e.and()
+	for len(e.tokens) > 0 && e.tokens[0] == "OR" {
+		e.next()
+		v = e.and() || v
+	}
+	return v
+}
+
+func (e *cursorConditionEval) and() bool {
+	v := e.primary()
+	for len(e.tokens) > 0 && e.tokens[0] == "AND" {
+		e.next()
+		v = e.primary() && v
+	}
+	return v
+}
+
+func (e *cursorConditionEval) primary() bool {
+	tok := e.next()
+	if tok == "(" {
+		v := e.or()
+		if e.next() != ")" && e.err == nil {
+			e.err = fmt.Errorf("expected ')'")
+		}
+		return v
+	}
+
+	column := tok
+	var value *string
+	if column == "id" {
+		v := strconv.Itoa(e.todo.Id)
+		value = &v
+	} else {
+		value = todoSortValue(e.todo, column)
+	}
+
+	op := e.next()
+	if op == "IS" {
+		not := len(e.tokens) > 0 && e.tokens[0] == "NOT"
+		if not {
+			e.next()
+		}
+		if e.next() != "NULL" && e.err == nil {
+			e.err = fmt.Errorf("expected NULL")
+		}
+		return (value == nil) != not
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(e.next(), "$"))
+	if err != nil || n < 1 || n > len(e.args) {
+		if e.err == nil {
+			e.err = fmt.Errorf("bad parameter")
+		}
+		return false
+	}
+	arg := fmt.Sprint(e.args[n-1])
+
+	// comparing to NULL is never true
+	if value == nil {
+		return false
+	}
+	c := compareSortValues(column, *value, arg)
+	switch op {
+	case "<":
+		return c < 0
+	case ">":
+		return c > 0
+	case "=":
+		return c == 0
+	}
+	if e.err == nil {
+		e.err = fmt.Errorf("unknown operator %q", op)
+	}
+	return false
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -0,0 +1,166 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/utils"
+	"github.com/lib/pq"
+)
+
+func (r *Repo) InsertRefreshToken(token *models.RefreshToken) error {
+	_, err := r.DB.Exec(QEInsertRefreshToken, token.UserId, token.FamilyId, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RotateRefreshToken consumes the refresh token with the given hash and stores
+// next in the same family. next.UserId and next.FamilyId are filled from the
+// consumed token.
+//
+// Presenting a token that was already used or revoked is treated as a replay:
+// the whole family is revoked, logging out both the attacker and the legit client.
+func (r *Repo) RotateRefreshToken(hash string, next *models.RefreshToken) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old := models.RefreshToken{TokenHash: hash}
+	err = tx.QueryRow(QOGetRefreshTokenByHashForUpdate, hash).Scan(
+		&old.Id,
+		&old.UserId,
+		&old.FamilyId,
+		&old.CreatedAt,
+		&old.ExpiresAt,
+		&old.UsedAt,
+		&old.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.UnauthorizedError()
+		}
+		return err
+	}
+
+	if old.UsedAt != nil || old.RevokedAt != nil {
+		slog.Warn("Refresh token reuse detected, revoking family", "userId", old.UserId, "familyId", old.FamilyId)
+		if _, err := tx.Exec(QERevokeRefreshTokenFamily, old.FamilyId); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return utils.UnauthorizedError()
+	}
+
+	if time.Now().UTC().After(old.ExpiresAt) {
+		return utils.UnauthorizedError()
+	}
+
+	if _, err := tx.Exec(QEMarkRefreshTokenUsed, old.Id); err != nil {
+		return err
+	}
+
+	next.UserId = old.UserId
+	next.FamilyId = old.FamilyId
+	if _, err := tx.Exec(QEInsertRefreshToken, next.UserId, next.FamilyId, next.TokenHash, next.ExpiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repo) RevokeAllRefreshTokensByUserId(uid int) error {
+	_, err := r.DB.Exec(QERevokeAllRefreshTokensByUser, uid)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repo) InsertPersonalAccessToken(token *models.PersonalAccessToken) error {
+	err := r.DB.QueryRow(QOInsertPersonalAccessToken,
+		token.UserId,
+		token.Name,
+		token.TokenHash,
+		pq.Array(token.Scopes),
+		token.CreatedAt,
+		token.ExpiresAt,
+	).Scan(&token.Id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NOTE: result is sorted by the creation date (most recent first)
+func (r *Repo) GetAllPersonalAccessTokensByUserId(uid int) ([]*models.PersonalAccessToken, error) {
+	tokens := []*models.PersonalAccessToken{}
+
+	rows, err := r.DB.Query(QMGetAllPersonalAccessTokensByUser, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := models.PersonalAccessToken{UserId: uid}
+		if err := rows.Scan(&t.Id, &t.Name, pq.Array(&t.Scopes), &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (r *Repo) DeletePersonalAccessTokenByIdAndUserId(tid, uid int) error {
+	res, err := r.DB.Exec(QEDeletePersonalAccessToken, tid, uid)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return utils.NotFoundError(fmt.Sprintf("no token with id %d found for user with id %d", tid, uid))
+	}
+
+	return nil
+}
+
+// UsePersonalAccessToken implements utils.TokenStore. It records the usage and
+// returns the owner and scopes of a valid, unexpired token.
+func (r *Repo) UsePersonalAccessToken(hash string) (int, []string, bool, error) {
+	var (
+		uid    int
+		scopes []string
+	)
+
+	err := r.DB.QueryRow(QOUsePersonalAccessToken, hash).Scan(&uid, pq.Array(&scopes))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil, false, nil
+		}
+		return 0, nil, false, err
+	}
+
+	return uid, scopes, true, nil
+}
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/assaidy/todo-api/models"
+)
+
+// UpsertTOTP stores the encrypted secret of a new enrollment. It doesn't
+// touch a confirmed one.
+func (r *Repo) UpsertTOTP(uid int, secret string) error {
+	_, err := r.DB.Exec(QEUpsertTOTP, uid, secret)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetTOTPByUserId returns nil if the user never started an enrollment.
+func (r *Repo) GetTOTPByUserId(uid int) (*models.TOTP, error) {
+	totp := &models.TOTP{UserId: uid}
+
+	err := r.DB.QueryRow(QOGetTOTPByUser, uid).Scan(&totp.Secret, &totp.CreatedAt, &totp.ConfirmedAt, &totp.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return totp, nil
+}
+
+// UseTOTPStep records that a code of the given time step was used. It returns
+// false if that step, or a later one, was used before.
+func (r *Repo) UseTOTPStep(uid int, step int64) (bool, error) {
+	return r.execAffectsRow(QEUseTOTPStep, uid, step)
+}
+
+// UseRecoveryCode burns the recovery code with the given hash. It returns
+// false if there's no such unused code.
+func (r *Repo) UseRecoveryCode(uid int, hash string) (bool, error) {
+	return r.execAffectsRow(QEUseRecoveryCode, uid, hash)
+}
+
+// ConfirmTOTP enables two-factor authentication for the user and replaces
+// their recovery codes.
+func (r *Repo) ConfirmTOTP(uid int, recoveryCodeHashes []string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(QEConfirmTOTP, uid); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(QEDeleteRecoveryCodesByUser, uid); err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(QEInsertRecoveryCode, uid, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repo) DeleteTOTP(uid int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(QEDeleteTOTP, uid); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(QEDeleteRecoveryCodesByUser, uid); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repo) execAffectsRow(query string, args ...any) (bool, error) {
+	res, err := r.DB.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affectedRows > 0, nil
+}
@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/utils"
+)
+
+// GetSavedViewsByUserId returns the user's saved views ordered by position.
+func (r *Repo) GetSavedViewsByUserId(uid int) ([]*models.SavedView, error) {
+	rows, err := r.DB.Query(QMGetSavedViewsByUser, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := []*models.SavedView{}
+	for rows.Next() {
+		v := models.SavedView{UserId: uid}
+		if err := rows.Scan(&v.Id, &v.Name, &v.Filter, &v.Sort, &v.Position, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		views = append(views, &v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return views, nil
+}
+
+func (r *Repo) GetSavedViewByIdAndUserId(id, uid int) (*models.SavedView, error) {
+	v := &models.SavedView{Id: id, UserId: uid}
+
+	err := r.DB.QueryRow(QOGetSavedViewByIdAndUser, id, uid).Scan(&v.Name, &v.Filter, &v.Sort, &v.Position, &v.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.NotFoundError(fmt.Sprintf("no view with id %d found", id))
+		}
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (r *Repo) CheckSavedViewNameExists(uid int, name string) (bool, error) {
+	err := r.DB.QueryRow(QOCheckSavedViewNameExists, uid, name).Scan(new(int))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// InsertSavedView inserts the view at its position, the views from there
+// on move one position down.
+func (r *Repo) InsertSavedView(v *models.SavedView) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(QOInsertSavedView, v.UserId, v.Name, v.Filter, v.Sort, v.Position).Scan(&v.Id, &v.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := placeSavedView(tx, v.UserId, v.Id, v.Position); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repo) UpdateSavedView(v *models.SavedView) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(QEUpdateSavedView, v.Name, v.Filter, v.Sort, v.Id, v.UserId)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return utils.NotFoundError(fmt.Sprintf("no view with id %d found", v.Id))
+	}
+
+	if err := placeSavedView(tx, v.UserId, v.Id, v.Position); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repo) DeleteSavedView(id, uid int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(QEDeleteSavedView, id, uid)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return utils.NotFoundError(fmt.Sprintf("no view with id %d found", id))
+	}
+
+	// close the gap the view left
+	if err := placeSavedView(tx, uid, 0, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func placeSavedView(tx *sql.Tx, uid, id, position int) error {
+	return place(tx, QMGetSavedViewPositionsForUpdate, QEUpdateSavedViewPosition, uid, id, position)
+}
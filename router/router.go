@@ -4,30 +4,82 @@ import (
 	"net/http"
 
 	"github.com/assaidy/todo-api/handlers"
+	"github.com/assaidy/todo-api/mailer"
 	"github.com/assaidy/todo-api/repo"
 	"github.com/assaidy/todo-api/utils"
 	"github.com/gorilla/mux"
 )
 
-func NewRouter(r *repo.Repo) http.Handler {
+func NewRouter(r *repo.Repo, m mailer.Mailer) http.Handler {
 	router := mux.NewRouter().StrictSlash(true)
 	protected := router.PathPrefix("").Subrouter()
-	protected.Use(utils.WithJWT)
+	protected.Use(utils.WithJWT(r))
 
-	userH := handlers.NewUserHandler(r)
+	userH := handlers.NewUserHandler(r, m)
 	todoH := handlers.NewTodoHandler(r)
+	authH := handlers.NewAuthHandler(r, m)
+	tokenH := handlers.NewTokenHandler(r)
+	twoFactorH := handlers.NewTwoFactorHandler(r)
+	statusH := handlers.NewStatusHandler(r)
+	tagH := handlers.NewTagHandler(r)
+	projectH := handlers.NewProjectHandler(r)
+	viewH := handlers.NewViewHandler(r)
 
-	router.HandleFunc("/register", utils.Make(userH.HandleRegisterUser)).Methods("POST")
-	router.HandleFunc("/login",    utils.Make(userH.HandleLoginUser)).Methods("POST")
-
-	protected.HandleFunc("/users/{id:[0-9]+}", utils.Make(userH.HandleDeleteUserById)).Methods("DELETE")
-	protected.HandleFunc("/users/{id:[0-9]+}", utils.Make(userH.HandleUpdateUserById)).Methods("PUT")
-	protected.HandleFunc("/todos",             utils.Make(todoH.HandleCreateTodo)).Methods("POST")
-	protected.HandleFunc("/todos",             utils.Make(todoH.HandleGetAllTodosByUser)).Methods("GET")
-	protected.HandleFunc("/todos",             utils.Make(todoH.HandleDeleteAllTodosByUser)).Methods("DELETE")
-	protected.HandleFunc("/todos/{id:[0-9]+}", utils.Make(todoH.HandleDeleteTodoById)).Methods("DELETE")
-	protected.HandleFunc("/todos/{id:[0-9]+}", utils.Make(todoH.HandleUpdateTodoById)).Methods("PUT")
-	// protected.HandleFunc("/todos/{id:[0-9+]}", utils.Make(todoH.HandleGetTodoById)).Methods("GET")
+	// personal access tokens are only let through routes tagged with one of their scopes
+	session := func(f utils.ApiFunc) http.HandlerFunc { return utils.RequireSession(utils.Make(f)) }
+	read := func(f utils.ApiFunc) http.HandlerFunc { return utils.RequireScope(utils.ScopeTodosRead, utils.Make(f)) }
+	write := func(f utils.ApiFunc) http.HandlerFunc { return utils.RequireScope(utils.ScopeTodosWrite, utils.Make(f)) }
+
+	router.HandleFunc("/register",              utils.Make(userH.HandleRegisterUser)).Methods("POST")
+	router.HandleFunc("/login",                 utils.Make(userH.HandleLoginUser)).Methods("POST")
+	router.HandleFunc("/login/2fa",             utils.Make(twoFactorH.HandleLoginTwoFactor)).Methods("POST")
+	router.HandleFunc("/token/refresh",         utils.Make(authH.HandleRefreshToken)).Methods("POST")
+	router.HandleFunc("/password/forgot",       utils.Make(authH.HandleForgotPassword)).Methods("POST")
+	router.HandleFunc("/password/reset",        utils.Make(authH.HandleResetPassword)).Methods("POST")
+	router.HandleFunc("/verify-email",          utils.Make(authH.HandleVerifyEmail)).Methods("GET")
+	router.HandleFunc("/.well-known/jwks.json", utils.Make(authH.HandleGetJWKS)).Methods("GET")
+
+	protected.HandleFunc("/logout",                                    session(authH.HandleLogout)).Methods("POST")
+	protected.HandleFunc("/verify-email/resend",                       session(authH.HandleResendVerificationEmail)).Methods("POST")
+	protected.HandleFunc("/users/{id:[0-9]+}",                         session(userH.HandleDeleteUserById)).Methods("DELETE")
+	protected.HandleFunc("/users/{id:[0-9]+}",                         session(userH.HandleUpdateUserById)).Methods("PUT")
+	protected.HandleFunc("/users/{id:[0-9]+}/tokens",                  session(tokenH.HandleCreateToken)).Methods("POST")
+	protected.HandleFunc("/users/{id:[0-9]+}/tokens",                  session(tokenH.HandleGetAllTokensByUser)).Methods("GET")
+	protected.HandleFunc("/users/{id:[0-9]+}/tokens/{tokenId:[0-9]+}", session(tokenH.HandleDeleteTokenById)).Methods("DELETE")
+	protected.HandleFunc("/users/{id:[0-9]+}/2fa",                     session(twoFactorH.HandleEnrollTwoFactor)).Methods("POST")
+	protected.HandleFunc("/users/{id:[0-9]+}/2fa/confirm",             session(twoFactorH.HandleConfirmTwoFactor)).Methods("POST")
+	protected.HandleFunc("/users/{id:[0-9]+}/2fa",                     session(twoFactorH.HandleDisableTwoFactor)).Methods("DELETE")
+	protected.HandleFunc("/todos",                                     write(todoH.HandleCreateTodo)).Methods("POST")
+	protected.HandleFunc("/todos",                                     read(todoH.HandleGetAllTodosByUser)).Methods("GET")
+	protected.HandleFunc("/todos",                                     write(todoH.HandleDeleteAllTodosByUser)).Methods("DELETE")
+	protected.HandleFunc("/todos/search",                              read(todoH.HandleSearchTodos)).Methods("GET")
+	protected.HandleFunc("/todos/{id:[0-9]+}",                         read(todoH.HandleGetTodoById)).Methods("GET")
+	protected.HandleFunc("/todos/{id:[0-9]+}",                         write(todoH.HandleDeleteTodoById)).Methods("DELETE")
+	protected.HandleFunc("/todos/{id:[0-9]+}",                         write(todoH.HandleUpdateTodoById)).Methods("PUT")
+	protected.HandleFunc("/todos/{id:[0-9]+}",                         write(todoH.HandlePatchTodoById)).Methods("PATCH")
+	protected.HandleFunc("/todos/{id:[0-9]+}/occurrences",             read(todoH.HandleGetTodoOccurrences)).Methods("GET")
+	protected.HandleFunc("/todos/{id:[0-9]+}/children",                read(todoH.HandleGetTodoChildren)).Methods("GET")
+	protected.HandleFunc("/todos/{id:[0-9]+}/tags/{tagId:[0-9]+}",     write(tagH.HandleAttachTag)).Methods("PUT")
+	protected.HandleFunc("/todos/{id:[0-9]+}/tags/{tagId:[0-9]+}",     write(tagH.HandleDetachTag)).Methods("DELETE")
+	protected.HandleFunc("/statuses",                                  write(statusH.HandleCreateStatus)).Methods("POST")
+	protected.HandleFunc("/statuses",                                  read(statusH.HandleGetAllStatusesByUser)).Methods("GET")
+	protected.HandleFunc("/statuses/{id:[0-9]+}",                      write(statusH.HandleUpdateStatusById)).Methods("PUT")
+	protected.HandleFunc("/statuses/{id:[0-9]+}",                      write(statusH.HandleDeleteStatusById)).Methods("DELETE")
+	protected.HandleFunc("/tags",                                      write(tagH.HandleCreateTag)).Methods("POST")
+	protected.HandleFunc("/tags",                                      read(tagH.HandleGetAllTagsByUser)).Methods("GET")
+	protected.HandleFunc("/tags/{id:[0-9]+}",                          write(tagH.HandleUpdateTagById)).Methods("PUT")
+	protected.HandleFunc("/tags/{id:[0-9]+}",                          write(tagH.HandleDeleteTagById)).Methods("DELETE")
+	protected.HandleFunc("/projects",                                  write(projectH.HandleCreateProject)).Methods("POST")
+	protected.HandleFunc("/projects",                                  read(projectH.HandleGetAllProjectsByUser)).Methods("GET")
+	protected.HandleFunc("/projects/{id:[0-9]+}",                      write(projectH.HandleUpdateProjectById)).Methods("PUT")
+	protected.HandleFunc("/projects/{id:[0-9]+}",                      write(projectH.HandleDeleteProjectById)).Methods("DELETE")
+	protected.HandleFunc("/projects/{id:[0-9]+}/todos",                read(todoH.HandleGetAllTodosByProject)).Methods("GET")
+	protected.HandleFunc("/views",                                     write(viewH.HandleCreateView)).Methods("POST")
+	protected.HandleFunc("/views",                                     read(viewH.HandleGetAllViewsByUser)).Methods("GET")
+	protected.HandleFunc("/views/{id:[0-9]+}",                         read(viewH.HandleGetViewById)).Methods("GET")
+	protected.HandleFunc("/views/{id:[0-9]+}",                         write(viewH.HandleUpdateViewById)).Methods("PUT")
+	protected.HandleFunc("/views/{id:[0-9]+}",                         write(viewH.HandleDeleteViewById)).Methods("DELETE")
+	protected.HandleFunc("/views/{id:[0-9]+}/todos",                   read(todoH.HandleGetTodosByView)).Methods("GET")
 
 	return router
 }
@@ -0,0 +1,32 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/assaidy/todo-api/mailer"
+	"github.com/assaidy/todo-api/models"
+)
+
+// EmailNotifier mails reminders to the user's address.
+type EmailNotifier struct {
+	Mailer mailer.Mailer
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, rem *models.Reminder) error {
+	body := fmt.Sprintf("Hi %s,\n\nthis is your reminder for \"%s\".\n", rem.UserName, rem.Title)
+	if rem.DueAt != nil {
+		loc, err := time.LoadLocation(rem.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		body += fmt.Sprintf("It's due %s.\n", rem.DueAt.In(loc).Format("Mon, 02 Jan 2006 15:04 MST"))
+	}
+
+	return n.Mailer.Send(ctx, mailer.Message{
+		To:      rem.UserEmail,
+		Subject: fmt.Sprintf("Reminder: %s", rem.Title),
+		Body:    body,
+	})
+}
@@ -0,0 +1,16 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/assaidy/todo-api/models"
+)
+
+// LogNotifier only logs reminders, it's meant for development.
+type LogNotifier struct{}
+
+func (n *LogNotifier) Notify(ctx context.Context, rem *models.Reminder) error {
+	slog.Info("Reminder", "userId", rem.UserId, "todoId", rem.TodoId, "title", rem.Title, "remindAt", rem.RemindAt)
+	return nil
+}
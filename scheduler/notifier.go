@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/assaidy/todo-api/config"
+	"github.com/assaidy/todo-api/mailer"
+	"github.com/assaidy/todo-api/models"
+)
+
+// Notifier delivers a reminder to its user. A returned error makes the
+// scheduler retry the delivery later.
+type Notifier interface {
+	Notify(ctx context.Context, rem *models.Reminder) error
+}
+
+// NewNotifier returns the notifier selected by config.ReminderNotifier.
+func NewNotifier(m mailer.Mailer) (Notifier, error) {
+	switch config.ReminderNotifier {
+	case "webhook":
+		if config.ReminderWebhookURL == "" {
+			return nil, fmt.Errorf("REMINDER_WEBHOOK_URL is required by the webhook notifier")
+		}
+		return NewWebhookNotifier(config.ReminderWebhookURL, config.ReminderWebhookSecret), nil
+	case "email":
+		return &EmailNotifier{Mailer: m}, nil
+	case "log":
+		return &LogNotifier{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown reminder notifier %q", config.ReminderNotifier)
+}
@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/assaidy/todo-api/config"
+	"github.com/assaidy/todo-api/models"
+	"github.com/assaidy/todo-api/repo"
+)
+
+const (
+	// reminders delivered at once by one scheduler
+	maxConcurrentDeliveries = 8
+	maxRetryDelay           = 6 * time.Hour
+)
+
+// Scheduler fires the reminders of todos. Deliveries are claimed with
+// SELECT ... FOR UPDATE SKIP LOCKED and leased while in flight, so any number
+// of replicas can run one against the same database. A reminder is delivered
+// at least once, it may be delivered twice if a replica dies mid-delivery.
+type Scheduler struct {
+	repo     *repo.Repo
+	notifier Notifier
+
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	retryBase   time.Duration
+	lease       time.Duration
+	maxDelay    time.Duration
+}
+
+func New(r *repo.Repo, n Notifier) *Scheduler {
+	return &Scheduler{
+		repo:        r,
+		notifier:    n,
+		interval:    time.Duration(config.ReminderPollSeconds) * time.Second,
+		batchSize:   config.ReminderBatchSize,
+		maxAttempts: config.ReminderMaxAttempts,
+		retryBase:   time.Duration(config.ReminderRetryBaseSeconds) * time.Second,
+		lease:       time.Duration(config.ReminderLeaseSeconds) * time.Second,
+		maxDelay:    time.Duration(config.ReminderMaxDelayHours) * time.Hour,
+	}
+}
+
+// Run polls for due reminders until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	slog.Info("Reminder scheduler started", "interval", s.interval.String())
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.tick(ctx); err != nil {
+			slog.Error("Failed to process reminders", "err", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick delivers due reminders batch by batch until none are left.
+func (s *Scheduler) tick(ctx context.Context) error {
+	if err := s.repo.EnqueueDueReminders(time.Now(), s.maxDelay); err != nil {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		reminders, err := s.repo.ClaimReminders(time.Now(), s.batchSize, s.lease)
+		if err != nil {
+			return err
+		}
+
+		s.deliverAll(ctx, reminders)
+
+		if len(reminders) < s.batchSize {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) deliverAll(ctx context.Context, reminders []*models.Reminder) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, maxConcurrentDeliveries)
+	)
+
+	for _, rem := range reminders {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(rem *models.Reminder) {
+			defer func() { <-sem; wg.Done() }()
+			s.deliver(ctx, rem)
+		}(rem)
+	}
+
+	wg.Wait()
+}
+
+func (s *Scheduler) deliver(ctx context.Context, rem *models.Reminder) {
+	// finish before the lease runs out and another replica picks it up
+	ctx, cancel := context.WithTimeout(ctx, s.lease)
+	defer cancel()
+
+	err := s.notifier.Notify(ctx, rem)
+	now := time.Now()
+
+	if err == nil {
+		if err := s.repo.MarkReminderDelivered(rem.DeliveryId, now); err != nil {
+			slog.Error("Failed to mark reminder delivered", "deliveryId", rem.DeliveryId, "err", err.Error())
+		}
+		return
+	}
+
+	slog.Warn("Failed to deliver reminder", "deliveryId", rem.DeliveryId, "attempt", rem.Attempts+1, "err", err.Error())
+
+	retryAt := now.Add(s.retryDelay(rem.Attempts + 1))
+	if err := s.repo.MarkReminderFailed(rem.DeliveryId, now, retryAt, s.maxAttempts, err.Error()); err != nil {
+		slog.Error("Failed to record reminder failure", "deliveryId", rem.DeliveryId, "err", err.Error())
+	}
+}
+
+// retryDelay is the exponential backoff after the given number of failed attempts.
+func (s *Scheduler) retryDelay(failures int) time.Duration {
+	delay := s.retryBase
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
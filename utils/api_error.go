@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -14,6 +15,12 @@ func (e ApiError) Error() string {
 	return fmt.Sprintf("api error: %d - %v", e.StatusCode, e.Msg)
 }
 
+// IsApiError reports whether err is an ApiError with the given status code.
+func IsApiError(err error, statusCode int) bool {
+	var apiErr ApiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
 func NewApiError(statusCode int, msg any) ApiError {
 	return ApiError{
 		StatusCode: statusCode,
@@ -44,3 +51,19 @@ func ForbiddenError() ApiError {
 func UnauthorizedError() ApiError {
 	return NewApiError(http.StatusUnauthorized, "Unauthorized")
 }
+
+func InvalidCredentialsError() ApiError {
+	return NewApiError(http.StatusUnauthorized, "invalid email or password")
+}
+
+func TooManyRequestsError(msg string) ApiError {
+	return NewApiError(http.StatusTooManyRequests, msg)
+}
+
+func PreconditionFailedError(msg string) ApiError {
+	return NewApiError(http.StatusPreconditionFailed, msg)
+}
+
+func ConflictError(msg string) ApiError {
+	return NewApiError(http.StatusConflict, msg)
+}
@@ -7,7 +7,6 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
-	"github.com/assaidy/todo-api/config"
 	"io"
 )
 
@@ -17,9 +16,8 @@ func generateKey(passphrase string) []byte {
 	return hash[:]
 }
 
-// Encrypt a plaintext string using AES-GCM with the given key
-func Encrypt(plaintext string) (string, error) {
-	passphrase := config.JWTSecret
+// Encrypt a plaintext string using AES-GCM with a key derived from passphrase
+func Encrypt(passphrase, plaintext string) (string, error) {
 	key := generateKey(passphrase)
 
 	// Create AES cipher
@@ -47,9 +45,8 @@ func Encrypt(plaintext string) (string, error) {
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt a base64-encoded ciphertext string using AES-GCM with the given key
-func Decrypt(ciphertextBase64 string) (string, error) {
-	passphrase := config.JWTSecret
+// Decrypt a base64-encoded ciphertext string using AES-GCM with a key derived from passphrase
+func Decrypt(passphrase, ciphertextBase64 string) (string, error) {
 	key := generateKey(passphrase)
 
 	// Decode the base64-encoded ciphertext
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/assaidy/todo-api/config"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SignCursor encodes v into an opaque pagination cursor. It's signed, so
+// clients can pass it back but not make up their own.
+func SignCursor(v any) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(cursorMAC(encoded)), nil
+}
+
+// ParseCursor checks the signature of a cursor made by SignCursor and decodes it into v.
+func ParseCursor(cursor string, v any) error {
+	encoded, sig, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return ErrInvalidCursor
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, cursorMAC(encoded)) {
+		return ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
+
+// CheckCursorSecret reports a missing config.CursorSecret where no key can
+// be derived for it. Only HS256 has a secret of its own to derive one from.
+func CheckCursorSecret() error {
+	if config.CursorSecret == "" && config.JWTSigningMethod != "HS256" {
+		return fmt.Errorf("CURSOR_SECRET must be set when JWT_SIGNING_METHOD is %s", config.JWTSigningMethod)
+	}
+	return nil
+}
+
+// cursorKey returns config.CursorSecret, or a key derived from the JWT
+// secret, so it's never used for two purposes.
+func cursorKey() []byte {
+	if config.CursorSecret != "" {
+		return []byte(config.CursorSecret)
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.JWTSecret))
+	mac.Write([]byte("cursor"))
+	return mac.Sum(nil)
+}
+
+func cursorMAC(encoded string) []byte {
+	mac := hmac.New(sha256.New, cursorKey())
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
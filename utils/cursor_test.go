@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/assaidy/todo-api/config"
+)
+
+type testCursor struct {
+	Id    int    `json:"id"`
+	Value string `json:"v"`
+}
+
+// setCursorKeys sets the secrets cursors are signed with for the rest of the test.
+func setCursorKeys(t *testing.T, cursorSecret, jwtSecret string) {
+	t.Helper()
+
+	oldCursorSecret, oldJWTSecret := config.CursorSecret, config.JWTSecret
+	t.Cleanup(func() { config.CursorSecret, config.JWTSecret = oldCursorSecret, oldJWTSecret })
+	config.CursorSecret, config.JWTSecret = cursorSecret, jwtSecret
+}
+
+func mustSignCursor(t *testing.T, v any) string {
+	t.Helper()
+
+	cursor, err := SignCursor(v)
+	if err != nil {
+		t.Fatalf("SignCursor: %v", err)
+	}
+	return cursor
+}
+
+func TestParseCursor(t *testing.T) {
+	for _, secret := range []string{"cursor-secret", ""} {
+		setCursorKeys(t, secret, "jwt-secret")
+
+		want := testCursor{Id: 42, Value: "2026-01-01T00:00:00Z"}
+		var got testCursor
+		if err := ParseCursor(mustSignCursor(t, want), &got); err != nil {
+			t.Fatalf("ParseCursor with CursorSecret %q: %v", secret, err)
+		}
+		if got != want {
+			t.Errorf("ParseCursor with CursorSecret %q = %+v, want %+v", secret, got, want)
+		}
+	}
+}
+
+func TestParseCursorRejectsTamperedCursors(t *testing.T) {
+	setCursorKeys(t, "cursor-secret", "jwt-secret")
+
+	cursor := mustSignCursor(t, testCursor{Id: 42})
+	encoded, sig, _ := strings.Cut(cursor, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"id":1}`))
+
+	// changes the first character of s, the last one may only hold padding bits
+	flip := func(s string) string {
+		if s[0] == 'A' {
+			return "B" + s[1:]
+		}
+		return "A" + s[1:]
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "empty", cursor: ""},
+		{name: "no signature", cursor: encoded},
+		{name: "empty signature", cursor: encoded + "."},
+		{name: "changed payload", cursor: forged + "." + sig},
+		{name: "changed payload byte", cursor: flip(encoded) + "." + sig},
+		{name: "changed signature", cursor: encoded + "." + flip(sig)},
+		{name: "truncated signature", cursor: encoded + "." + sig[:len(sig)-2]},
+		{name: "signature of another cursor", cursor: encoded + "." + strings.SplitN(mustSignCursor(t, testCursor{Id: 1}), ".", 2)[1]},
+		{name: "signature isn't base64", cursor: encoded + ".!!!"},
+		{name: "extra part", cursor: cursor + ".x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testCursor
+			if err := ParseCursor(tt.cursor, &got); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("ParseCursor(%q) = %+v, %v, want ErrInvalidCursor", tt.cursor, got, err)
+			}
+		})
+	}
+}
+
+func TestParseCursorRejectsOtherKeys(t *testing.T) {
+	tests := []struct {
+		name                 string
+		signedWith, parsedBy [2]string // CursorSecret, JWTSecret
+	}{
+		{name: "another cursor secret", signedWith: [2]string{"a", "jwt"}, parsedBy: [2]string{"b", "jwt"}},
+		{name: "derived and given key", signedWith: [2]string{"", "jwt"}, parsedBy: [2]string{"jwt", "jwt"}},
+		{name: "given and derived key", signedWith: [2]string{"jwt", "jwt"}, parsedBy: [2]string{"", "jwt"}},
+		{name: "keys derived from another JWT secret", signedWith: [2]string{"", "jwt-a"}, parsedBy: [2]string{"", "jwt-b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCursorKeys(t, tt.signedWith[0], tt.signedWith[1])
+			cursor := mustSignCursor(t, testCursor{Id: 42})
+
+			setCursorKeys(t, tt.parsedBy[0], tt.parsedBy[1])
+			var got testCursor
+			if err := ParseCursor(cursor, &got); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("ParseCursor = %+v, %v, want ErrInvalidCursor", got, err)
+			}
+		})
+	}
+}
+
+// the JWT secret itself must not sign cursors, or a cursor's signature would
+// be an HMAC made with the key that signs tokens
+func TestCursorKeyIsDerived(t *testing.T) {
+	setCursorKeys(t, "", "jwt-secret")
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(`{"id":42}`))
+	mac := hmac.New(sha256.New, []byte("jwt-secret"))
+	mac.Write([]byte(encoded))
+	cursor := encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	var got testCursor
+	if err := ParseCursor(cursor, &got); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("ParseCursor = %+v, %v, want ErrInvalidCursor", got, err)
+	}
+}
+
+func TestCheckCursorSecret(t *testing.T) {
+	oldSecret, oldMethod := config.CursorSecret, config.JWTSigningMethod
+	t.Cleanup(func() { config.CursorSecret, config.JWTSigningMethod = oldSecret, oldMethod })
+
+	tests := []struct {
+		secret, method string
+		ok             bool
+	}{
+		{secret: "", method: "HS256", ok: true},
+		{secret: "", method: "RS256", ok: false},
+		{secret: "", method: "EdDSA", ok: false},
+		{secret: "cursor-secret", method: "RS256", ok: true},
+	}
+
+	for _, tt := range tests {
+		config.CursorSecret, config.JWTSigningMethod = tt.secret, tt.method
+		if err := CheckCursorSecret(); (err == nil) != tt.ok {
+			t.Errorf("CheckCursorSecret with %q and %s = %v, want ok %v", tt.secret, tt.method, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// VersionETag returns the strong entity tag of a resource at version.
+func VersionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ETagMatches reports whether the value of an If-None-Match header matches
+// etag. Weak validators compare equal to their strong counterpart, which is
+// what If-None-Match asks for.
+func ETagMatches(header, etag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IfMatch reports whether the value of an If-Match header matches etag.
+// Unlike If-None-Match it uses the strong comparison, so weak validators never match.
+func IfMatch(header, etag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if !strings.HasPrefix(candidate, "W/") && candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,8 +2,13 @@ package utils
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+
+	"github.com/assaidy/todo-api/config"
 )
 
 type ApiFunc func(w http.ResponseWriter, r *http.Request) error
@@ -54,3 +59,43 @@ func ParseJSON(r *http.Request, v any) error {
 
 	return nil
 }
+
+// ClientIP returns the address the request came from. X-Forwarded-For is only
+// considered when config.TrustProxyHeaders is set, otherwise any client could spoof it.
+func ClientIP(r *http.Request) string {
+	if config.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			// the left-most address is the original client
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequestURLWith returns the path and query of the request with the query
+// parameters in params set to their value, or removed if it's empty.
+func RequestURLWith(r *http.Request, params map[string]string) string {
+	q := r.URL.Query()
+	for k, v := range params {
+		if v == "" {
+			q.Del(k)
+		} else {
+			q.Set(k, v)
+		}
+	}
+
+	if len(q) == 0 {
+		return r.URL.Path
+	}
+	return r.URL.Path + "?" + q.Encode()
+}
+
+// AddLink adds an RFC 8288 Link header to url with the relation rel.
+func AddLink(w http.ResponseWriter, rel, url string) {
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="%s"`, url, rel))
+}
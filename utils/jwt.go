@@ -3,6 +3,7 @@ package utils
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -12,39 +13,137 @@ import (
 )
 
 const (
-	userIDKey  = "userId"
-	authHeader = "Authorization"
+	userIDKey   = "userId"
+	tokenKey    = "token"
+	scopesKey   = "scopes"
+	readOnlyKey = "readOnly"
+	authHeader  = "Authorization"
 )
 
-// Middleware to check JWT and extract userId
-func WithJWT(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := extractTokenFromHeader(r)
-		if tokenString == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		claims, err := parseToken(tokenString)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		// Expecting userId as a float64 from claims (since JWT uses float64 for numbers)
-		userIdFloat, ok := claims["userId"].(float64)
-		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		userId := int(userIdFloat) // Convert float64 to int
-
-		// Add userId to context
-		ctx := context.WithValue(r.Context(), userIDKey, userId)
-		r = r.WithContext(ctx)
-		next.ServeHTTP(w, r)
-	})
+// TokenStore holds the server-side token state consulted by WithJWT.
+type TokenStore interface {
+	IsTokenRevoked(jti string, userId int, issuedAt time.Time) (bool, error)
+	// UsePersonalAccessToken returns the owner and scopes of a valid
+	// personal access token, ok is false if it's unknown or expired.
+	UsePersonalAccessToken(hash string) (userId int, scopes []string, ok bool, err error)
+	// IsEmailVerified is only consulted when config.RequireVerifiedEmail is set.
+	IsEmailVerified(userId int) (bool, error)
+}
+
+// TokenInfo describes the token a request was authenticated with.
+type TokenInfo struct {
+	Id        string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+var errUnauthorized = errors.New("unauthorized")
+
+// Middleware to check JWT (or personal access token) and extract userId
+func WithJWT(store TokenStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := extractTokenFromHeader(r)
+			if tokenString == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var (
+				ctx context.Context
+				err error
+			)
+			if IsPersonalAccessToken(tokenString) {
+				ctx, err = authenticatePersonalAccessToken(r.Context(), store, tokenString)
+			} else {
+				ctx, err = authenticateJWT(r.Context(), store, tokenString)
+			}
+			if err == nil && config.RequireVerifiedEmail {
+				ctx, err = markUnverifiedReadOnly(ctx, store)
+			}
+			if err != nil {
+				if errors.Is(err, errUnauthorized) {
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				slog.Error("Failed to authenticate request", "err", err.Error())
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			r = r.WithContext(ctx)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func authenticateJWT(ctx context.Context, store TokenStore, tokenString string) (context.Context, error) {
+	userId, info, err := ParseAccessToken(tokenString)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	revoked, err := store.IsTokenRevoked(info.Id, userId, info.IssuedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errUnauthorized
+	}
+
+	// Add userId and token info to context
+	ctx = context.WithValue(ctx, userIDKey, userId)
+	ctx = context.WithValue(ctx, tokenKey, info)
+	return ctx, nil
+}
+
+// ParseAccessToken validates a token created by CreateToken. It doesn't
+// check whether the token has been revoked.
+func ParseAccessToken(tokenString string) (int, TokenInfo, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return 0, TokenInfo{}, ErrInvalidToken
+	}
+
+	// tokens issued before the typ claim was introduced are access tokens
+	if typ, ok := claims["typ"].(string); ok && typ != tokenTypeAccess {
+		return 0, TokenInfo{}, ErrInvalidToken
+	}
+
+	// Expecting userId as a float64 from claims (since JWT uses float64 for numbers)
+	userIdFloat, ok := claims["userId"].(float64)
+	if !ok {
+		return 0, TokenInfo{}, ErrInvalidClaims
+	}
+
+	return int(userIdFloat), tokenInfo(claims), nil
+}
+
+func authenticatePersonalAccessToken(ctx context.Context, store TokenStore, tokenString string) (context.Context, error) {
+	userId, scopes, ok, err := store.UsePersonalAccessToken(HashOpaqueToken(tokenString))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	ctx = context.WithValue(ctx, userIDKey, userId)
+	ctx = context.WithValue(ctx, scopesKey, scopes)
+	return ctx, nil
+}
+
+// markUnverifiedReadOnly restricts users who haven't verified their email
+// address yet to read scopes, see RequireScope.
+func markUnverifiedReadOnly(ctx context.Context, store TokenStore) (context.Context, error) {
+	userId, _ := GetUserIdFromContext(ctx)
+
+	verified, err := store.IsEmailVerified(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return context.WithValue(ctx, readOnlyKey, !verified), nil
 }
 
 // Extract JWT token from the Authorization header
@@ -58,17 +157,7 @@ func extractTokenFromHeader(r *http.Request) string {
 
 // Parse and validate the JWT token
 func parseToken(tokenString string) (jwt.MapClaims, error) {
-	// Replace "your-secret-key" with your actual JWT secret key
-	secretKey := []byte(config.JWTSecret)
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Ensure the token method is what you expect
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return secretKey, nil
-	})
-
+	token, err := jwt.Parse(tokenString, jwtKeys.verificationKey)
 	if err != nil || !token.Valid {
 		return nil, err
 	}
@@ -81,25 +170,98 @@ func parseToken(tokenString string) (jwt.MapClaims, error) {
 	return claims, nil
 }
 
+// Token types, set in the "typ" claim. Only access tokens authenticate requests.
+const (
+	tokenTypeAccess    = "access"
+	tokenTypeChallenge = "2fa_challenge"
+)
+
 // CreateToken generates a JWT token for a userId
 func CreateToken(userId int) (string, error) {
-	// Replace with your own secret key
-	secretKey := []byte(config.JWTSecret)
+	// Access tokens are short-lived, clients renew them with a refresh token
+	return createToken(userId, tokenTypeAccess, time.Minute*time.Duration(config.JWTExpirationMinutes))
+}
+
+// CreateChallengeToken generates the token a user who passed the password
+// check exchanges, along with a second factor, for an access token.
+func CreateChallengeToken(userId int) (string, error) {
+	return createToken(userId, tokenTypeChallenge, time.Minute*time.Duration(config.TwoFactorChallengeMinutes))
+}
 
-	// Set token expiration time (e.g., 24 hours)
-	expirationTime := time.Now().Add(time.Hour * time.Duration(config.JWTExpirationHours))
+// ParseChallengeToken validates a token created by CreateChallengeToken.
+func ParseChallengeToken(tokenString string) (int, TokenInfo, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return 0, TokenInfo{}, ErrInvalidToken
+	}
+
+	if typ, _ := claims["typ"].(string); typ != tokenTypeChallenge {
+		return 0, TokenInfo{}, ErrInvalidToken
+	}
+
+	userIdFloat, ok := claims["userId"].(float64)
+	if !ok {
+		return 0, TokenInfo{}, ErrInvalidClaims
+	}
+
+	return int(userIdFloat), tokenInfo(claims), nil
+}
+
+// tokenInfo reads the jti, issue and expiration time of a token. The issue
+// time comes in milliseconds from iat_ms, tokens issued before it was
+// introduced only have the seconds of iat.
+func tokenInfo(claims jwt.MapClaims) TokenInfo {
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	issuedAt := time.Time{}
+	if ms, ok := claims["iat_ms"].(float64); ok {
+		issuedAt = time.UnixMilli(int64(ms))
+	} else {
+		iat, _ := claims["iat"].(float64)
+		issuedAt = time.Unix(int64(iat), 0)
+	}
+
+	return TokenInfo{
+		Id:        jti,
+		IssuedAt:  issuedAt.UTC(),
+		ExpiresAt: time.Unix(int64(exp), 0).UTC(),
+	}
+}
+
+func createToken(userId int, typ string, ttl time.Duration) (string, error) {
+	key, kid := jwtKeys.signing()
+
+	now := time.Now()
+	expirationTime := now.Add(ttl)
+
+	// jti identifies the token so it can be revoked on its own
+	jti, err := RandomString(16)
+	if err != nil {
+		return "", err
+	}
 
 	// Create JWT claims, including userId and expiration
 	claims := jwt.MapClaims{
 		"userId": userId,
+		"typ":    typ,
+		"jti":    jti,
+		"iat":    now.Unix(),
+		// iat only has seconds, too coarse to tell whether the token was
+		// issued before or after its user's tokens were all revoked
+		"iat_ms": now.UnixMilli(),
 		"exp":    expirationTime.Unix(),
 	}
 
 	// Create the token using the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(jwtKeys.method, claims)
+	if kid != "" {
+		// tells verifiers which key of the JWKS to use
+		token.Header["kid"] = kid
+	}
 
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString(secretKey)
+	// Sign the token with the active key
+	tokenString, err := token.SignedString(key)
 	if err != nil {
 		return "", err
 	}
@@ -113,6 +275,12 @@ func GetUserIdFromContext(ctx context.Context) (int, bool) {
 	return userID, ok
 }
 
+// Retrieve the current token info from request context
+func GetTokenInfoFromContext(ctx context.Context) (TokenInfo, bool) {
+	info, ok := ctx.Value(tokenKey).(TokenInfo)
+	return info, ok
+}
+
 var (
 	ErrInvalidToken  = errors.New("invalid token")
 	ErrInvalidClaims = errors.New("invalid claims")
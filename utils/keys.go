@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/assaidy/todo-api/config"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// keySet holds the key used to sign new tokens and every key tokens are
+// accepted with. For HS256 it's just config.JWTSecret. For RS256 and EdDSA
+// each key lives in its own PEM file named "<kid>.pem" so that old keys can
+// stay around for verification while a new one is used for signing.
+type keySet struct {
+	method     jwt.SigningMethod
+	signingKid string
+	signingKey crypto.PrivateKey
+	publicKeys map[string]crypto.PublicKey
+	hmacSecret []byte
+}
+
+var jwtKeys = &keySet{
+	method:     jwt.SigningMethodHS256,
+	hmacSecret: []byte(config.JWTSecret),
+}
+
+var (
+	ErrUnknownSigningMethod = errors.New("unknown jwt signing method")
+	ErrUnknownKeyId         = errors.New("unknown jwt key id")
+)
+
+// LoadJWTKeys loads the signing and verification keys from config.JWTKeysDir
+// according to config.JWTSigningMethod. It must be called before serving
+// requests when an asymmetric signing method is configured.
+func LoadJWTKeys() error {
+	switch config.JWTSigningMethod {
+	case jwt.SigningMethodHS256.Alg():
+		jwtKeys = &keySet{
+			method:     jwt.SigningMethodHS256,
+			hmacSecret: []byte(config.JWTSecret),
+		}
+		return nil
+	case jwt.SigningMethodRS256.Alg(), SigningMethodEdDSA.Alg():
+	default:
+		return ErrUnknownSigningMethod
+	}
+
+	keys := &keySet{
+		method:     jwt.GetSigningMethod(config.JWTSigningMethod),
+		signingKid: config.JWTSigningKeyId,
+		publicKeys: map[string]crypto.PublicKey{},
+	}
+
+	files, err := filepath.Glob(filepath.Join(config.JWTKeysDir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		private, public, err := parsePEMKey(data)
+		if err != nil {
+			return fmt.Errorf("jwt key %s: %w", file, err)
+		}
+		if !keyMatchesMethod(public, keys.method) {
+			// keys for another algorithm can't verify our tokens, skip them
+			continue
+		}
+
+		keys.publicKeys[kid] = public
+		if kid == keys.signingKid {
+			if private == nil {
+				return fmt.Errorf("jwt signing key %s: not a private key", file)
+			}
+			keys.signingKey = private
+		}
+	}
+
+	if keys.signingKey == nil {
+		return fmt.Errorf("no %s private key with id %q found in %s",
+			config.JWTSigningMethod, keys.signingKid, config.JWTKeysDir)
+	}
+
+	jwtKeys = keys
+	return nil
+}
+
+// parsePEMKey accepts PKCS#8 private keys, PKCS#1 RSA private keys and PKIX
+// public keys. private is nil for public keys.
+func parsePEMKey(data []byte) (crypto.PrivateKey, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, k.Public(), nil
+		case ed25519.PrivateKey:
+			return k, k.Public(), nil
+		}
+		return nil, nil, errors.New("unsupported private key type")
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, key.Public(), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, key, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+}
+
+func keyMatchesMethod(key crypto.PublicKey, method jwt.SigningMethod) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return method == jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		return method == SigningMethodEdDSA
+	}
+	return false
+}
+
+// signing returns the key and kid new tokens are signed with.
+// kid is empty for HS256.
+func (ks *keySet) signing() (any, string) {
+	if ks.method == jwt.SigningMethodHS256 {
+		return ks.hmacSecret, ""
+	}
+	return ks.signingKey, ks.signingKid
+}
+
+// verificationKey is the jwt.Keyfunc used by parseToken.
+func (ks *keySet) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if ks.method == jwt.SigningMethodHS256 {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || kid != "" {
+			return nil, ErrInvalidToken
+		}
+		return ks.hmacSecret, nil
+	}
+
+	key, ok := ks.publicKeys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyId
+	}
+	// never let the token pick an algorithm its key wasn't made for
+	if !keyMatchesMethod(key, token.Method) {
+		return nil, ErrInvalidToken
+	}
+
+	return key, nil
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public verification keys. It's empty for HS256 since the
+// secret can't be published.
+func JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	kids := make([]string, 0, len(jwtKeys.publicKeys))
+	for kid := range jwtKeys.publicKeys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		key := jwtKeys.publicKeys[kid]
+		jwk := JSONWebKey{
+			Kid: kid,
+			Alg: jwtKeys.method.Alg(),
+			Use: "sig",
+		}
+
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// SigningMethodEdDSA implements the EdDSA (Ed25519) signing method, which
+// jwt-go v3 doesn't ship with.
+var SigningMethodEdDSA = &signingMethodEd25519{}
+
+type signingMethodEd25519 struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEd25519) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEd25519) Sign(signingString string, key any) (string, error) {
+	k, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(k, []byte(signingString))), nil
+}
+
+func (m *signingMethodEd25519) Verify(signingString, signature string, key any) error {
+	k, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(k, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
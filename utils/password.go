@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/assaidy/todo-api/config"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+	argon2Prefix  = "$argon2id$"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// CheckPasswordHashParams reports configured argon2 cost parameters that are
+// out of range, argon2 would panic on them or they'd wrap around.
+func CheckPasswordHashParams() error {
+	if config.PasswordHashMemoryKiB < 1 || int64(config.PasswordHashMemoryKiB) > math.MaxUint32 {
+		return fmt.Errorf("PASSWORD_HASH_MEMORY_KIB must be between 1 and %d, got %d", uint32(math.MaxUint32), config.PasswordHashMemoryKiB)
+	}
+	if config.PasswordHashIterations < 1 || int64(config.PasswordHashIterations) > math.MaxUint32 {
+		return fmt.Errorf("PASSWORD_HASH_ITERATIONS must be between 1 and %d, got %d", uint32(math.MaxUint32), config.PasswordHashIterations)
+	}
+	if config.PasswordHashParallelism < 1 || config.PasswordHashParallelism > math.MaxUint8 {
+		return fmt.Errorf("PASSWORD_HASH_PARALLELISM must be between 1 and %d, got %d", math.MaxUint8, config.PasswordHashParallelism)
+	}
+	return nil
+}
+
+func currentArgon2Params() argon2Params {
+	return argon2Params{
+		memory:      uint32(config.PasswordHashMemoryKiB),
+		iterations:  uint32(config.PasswordHashIterations),
+		parallelism: uint8(config.PasswordHashParallelism),
+	}
+}
+
+// HashPassword hashes the password with argon2id using the configured cost
+// and returns it in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	p := currentArgon2Params()
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, argon2KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix,
+		argon2.Version,
+		p.memory,
+		p.iterations,
+		p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword reports whether password matches the stored hash.
+// needsRehash is true when the stored value was produced with different
+// cost parameters or is a legacy AES-encrypted password, in which case the
+// caller should store a fresh HashPassword result.
+func VerifyPassword(password, stored string) (match, needsRehash bool, err error) {
+	if !strings.HasPrefix(stored, argon2Prefix) {
+		return verifyLegacyPassword(password, stored), true, nil
+	}
+
+	p, salt, key, err := decodeArgon2Hash(stored)
+	if err != nil {
+		return false, false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	return true, p != currentArgon2Params() || len(key) != argon2KeyLen, nil
+}
+
+func decodeArgon2Hash(encoded string) (argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	p := argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	// argon2 panics on these
+	if p.iterations == 0 || p.parallelism == 0 {
+		return argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
+
+// verifyLegacyPassword checks passwords stored by older versions of the api,
+// which were AES-encrypted instead of hashed.
+func verifyLegacyPassword(password, ciphertext string) bool {
+	plaintext, err := Decrypt(config.PasswordLegacyKey, ciphertext)
+	if err != nil {
+		slog.Warn("Failed to decrypt legacy password", "err", err.Error())
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(password), []byte(plaintext)) == 1
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// DummyVerifyPassword costs as much as VerifyPassword against a real hash.
+// Use it when there is no user to check against, so response times don't
+// reveal whether an account exists.
+func DummyVerifyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy password")
+	})
+	VerifyPassword(password, dummyHash)
+}
@@ -0,0 +1,392 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// assertJSONEqual fails unless got and want hold the same JSON value.
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		// RFC 6902, appendix A
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name: "A.8 testing a value: success",
+			doc:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[
+				{"op": "test", "path": "/baz", "value": "qux"},
+				{"op": "test", "path": "/foo/1", "value": 2}
+			]`,
+			want: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:  "A.9 testing a value: error",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			err:   ErrPatchTestFailed,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:  "A.12 adding to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "A.13 invalid JSON patch document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "op": "remove"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "A.14 ~ escape ordering",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": 10}]`,
+			want:  `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:  "A.15 comparing strings and numbers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			err:   ErrPatchTestFailed,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+
+		// array indexes
+		{
+			name:  "add appends with -",
+			doc:   `{"tags": ["a"]}`,
+			patch: `[{"op": "add", "path": "/tags/-", "value": "b"}, {"op": "add", "path": "/tags/-", "value": "c"}]`,
+			want:  `{"tags": ["a", "b", "c"]}`,
+		},
+		{
+			name:  "add at the length appends",
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: `[{"op": "add", "path": "/tags/2", "value": "c"}]`,
+			want:  `{"tags": ["a", "b", "c"]}`,
+		},
+		{
+			name:  "add past the length",
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: `[{"op": "add", "path": "/tags/3", "value": "c"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "index with a leading zero",
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: `[{"op": "add", "path": "/tags/01", "value": "c"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "negative index",
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: `[{"op": "remove", "path": "/tags/-1"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "remove with -",
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: `[{"op": "remove", "path": "/tags/-"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "remove past the end",
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: `[{"op": "remove", "path": "/tags/2"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "move to the front",
+			doc:   `{"tags": ["a", "b", "c"]}`,
+			patch: `[{"op": "move", "from": "/tags/2", "path": "/tags/0"}]`,
+			want:  `{"tags": ["c", "a", "b"]}`,
+		},
+		{
+			name:  "move to the end with -",
+			doc:   `{"tags": ["a", "b", "c"]}`,
+			patch: `[{"op": "move", "from": "/tags/0", "path": "/tags/-"}]`,
+			want:  `{"tags": ["b", "c", "a"]}`,
+		},
+		{
+			name:  "move indexes the array without the moved element",
+			doc:   `{"tags": ["a", "b", "c"]}`,
+			patch: `[{"op": "move", "from": "/tags/0", "path": "/tags/3"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "move between arrays",
+			doc:   `{"a": [1, 2], "b": [3]}`,
+			patch: `[{"op": "move", "from": "/a/0", "path": "/b/1"}]`,
+			want:  `{"a": [2], "b": [3, 1]}`,
+		},
+		{
+			name:  "move into itself",
+			doc:   `{"a": {"b": {}}}`,
+			patch: `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "move to a sibling with a common prefix",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "move", "from": "/a", "path": "/ab"}]`,
+			want:  `{"ab": 1}`,
+		},
+		{
+			name:  "copy to the front",
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: `[{"op": "copy", "from": "/tags/1", "path": "/tags/0"}]`,
+			want:  `{"tags": ["b", "a", "b"]}`,
+		},
+		{
+			name:  "copy to the end with -",
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: `[{"op": "copy", "from": "/tags/0", "path": "/tags/-"}]`,
+			want:  `{"tags": ["a", "b", "a"]}`,
+		},
+		{
+			name:  "copy past the end",
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: `[{"op": "copy", "from": "/tags/0", "path": "/tags/3"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name: "copies don't share their values",
+			doc:  `{"a": {"b": [1]}}`,
+			patch: `[
+				{"op": "copy", "from": "/a", "path": "/c"},
+				{"op": "add", "path": "/c/b/-", "value": 2},
+				{"op": "replace", "path": "/a/b/0", "value": 0}
+			]`,
+			want: `{"a": {"b": [0]}, "c": {"b": [1, 2]}}`,
+		},
+		{
+			name:  "copy from a missing value",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "copy", "from": "/b", "path": "/c"}]`,
+			err:   ErrInvalidPatch,
+		},
+
+		// everything else
+		{
+			name:  "test an object",
+			doc:   `{"a": {"b": [1, "x", null]}}`,
+			patch: `[{"op": "test", "path": "/a", "value": {"b": [1, "x", null]}}]`,
+			want:  `{"a": {"b": [1, "x", null]}}`,
+		},
+		{
+			name:  "test a missing value",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "test", "path": "/b", "value": 1}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "a failed test discards earlier operations",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "/a", "value": 2}, {"op": "test", "path": "/a", "value": 1}]`,
+			err:   ErrPatchTestFailed,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "", "value": [1]}]`,
+			want:  `[1]`,
+		},
+		{
+			name:  "replace a missing value",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "/b", "value": 2}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "remove a missing value",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "remove", "path": "/b"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "remove the whole document",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "remove", "path": ""}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "add null",
+			doc:   `{}`,
+			patch: `[{"op": "add", "path": "/a", "value": null}]`,
+			want:  `{"a": null}`,
+		},
+		{
+			name:  "missing value",
+			doc:   `{}`,
+			patch: `[{"op": "add", "path": "/a"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "missing path",
+			doc:   `{}`,
+			patch: `[{"op": "add", "value": 1}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "missing from",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "move", "path": "/b"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "pointer without a leading slash",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "remove", "path": "a"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "unknown op",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "increment", "path": "/a"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "not an array of operations",
+			doc:   `{"a": 1}`,
+			patch: `{"op": "remove", "path": "/a"}`,
+			err:   ErrInvalidPatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyJSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ApplyJSONPatch = %s, %v, want %v", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyJSONPatch: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	// RFC 7396, appendix A
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{doc: `{"a": "b"}`, patch: `{"a": "c"}`, want: `{"a": "c"}`},
+		{doc: `{"a": "b"}`, patch: `{"b": "c"}`, want: `{"a": "b", "b": "c"}`},
+		{doc: `{"a": "b"}`, patch: `{"a": null}`, want: `{}`},
+		{doc: `{"a": "b", "b": "c"}`, patch: `{"a": null}`, want: `{"b": "c"}`},
+		{doc: `{"a": ["b"]}`, patch: `{"a": "c"}`, want: `{"a": "c"}`},
+		{doc: `{"a": "c"}`, patch: `{"a": ["b"]}`, want: `{"a": ["b"]}`},
+		{doc: `{"a": {"b": "c"}}`, patch: `{"a": {"b": "d", "c": null}}`, want: `{"a": {"b": "d"}}`},
+		{doc: `{"a": [{"b": "c"}]}`, patch: `{"a": [1]}`, want: `{"a": [1]}`},
+		{doc: `["a", "b"]`, patch: `["c", "d"]`, want: `["c", "d"]`},
+		{doc: `{"a": "b"}`, patch: `["c"]`, want: `["c"]`},
+		{doc: `{"a": "foo"}`, patch: `null`, want: `null`},
+		{doc: `{"a": "foo"}`, patch: `"bar"`, want: `"bar"`},
+		{doc: `{"e": null}`, patch: `{"a": 1}`, want: `{"e": null, "a": 1}`},
+		{doc: `[1, 2]`, patch: `{"a": "b", "c": null}`, want: `{"a": "b"}`},
+		{doc: `{}`, patch: `{"a": {"bb": {"ccc": null}}}`, want: `{"a": {"bb": {}}}`},
+		// deleting a member that isn't there
+		{doc: `{"a": 1}`, patch: `{"b": null}`, want: `{"a": 1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.doc+" "+tt.patch, func(t *testing.T) {
+			got, err := ApplyMergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("ApplyMergePatch: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+
+	if _, err := ApplyMergePatch([]byte(`{}`), []byte(`{"a":`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("ApplyMergePatch with invalid JSON = %v, want ErrInvalidPatch", err)
+	}
+}
@@ -0,0 +1,429 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies supported by RRule.
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// stop expanding rules that can't produce a further occurrence, e.g. the 31st
+// of every 12th month starting in a month with 30 days, after this many
+// periods in a row without one
+const maxRRuleEmptyPeriods = 10000
+
+var ErrInvalidRRule = errors.New("invalid recurrence rule")
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// RRuleWeekday is a BYDAY entry. N selects the n-th (or, if negative, n-th
+// last) such weekday of the month, 0 means every one of them.
+type RRuleWeekday struct {
+	N       int
+	Weekday time.Weekday
+}
+
+// RRule is the subset of RFC 5545 recurrence rules todos support: DAILY,
+// WEEKLY and MONTHLY frequencies with INTERVAL, BYDAY, BYMONTHDAY, COUNT and
+// UNTIL. Weeks start on Monday.
+type RRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []RRuleWeekday
+	ByMonthDay []int
+	Count      int
+	Until      *time.Time
+}
+
+// ParseRRule parses a rule like "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", with or
+// without the "RRULE:" prefix.
+func ParseRRule(s string) (*RRule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("%w: empty rule", ErrInvalidRRule)
+	}
+
+	rule := &RRule{Interval: 1}
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalidRRule, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s given twice", ErrInvalidRRule, name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+			if rule.Freq != FreqDaily && rule.Freq != FreqWeekly && rule.Freq != FreqMonthly {
+				return nil, fmt.Errorf("%w: unsupported FREQ %s", ErrInvalidRRule, value)
+			}
+		case "INTERVAL":
+			if rule.Interval, err = strconv.Atoi(value); err != nil || rule.Interval < 1 {
+				return nil, fmt.Errorf("%w: INTERVAL must be a positive number", ErrInvalidRRule)
+			}
+		case "COUNT":
+			if rule.Count, err = strconv.Atoi(value); err != nil || rule.Count < 1 {
+				return nil, fmt.Errorf("%w: COUNT must be a positive number", ErrInvalidRRule)
+			}
+		case "UNTIL":
+			until, err := parseRRuleUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := parseRRuleWeekday(v)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := strconv.Atoi(v)
+				if err != nil || day == 0 || day < -31 || day > 31 {
+					return nil, fmt.Errorf("%w: invalid BYMONTHDAY %s", ErrInvalidRRule, v)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, day)
+			}
+		case "WKST":
+			if strings.ToUpper(value) != "MO" {
+				return nil, fmt.Errorf("%w: only WKST=MO is supported", ErrInvalidRRule)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unsupported part %s", ErrInvalidRRule, name)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRRule)
+	}
+	if rule.Count > 0 && rule.Until != nil {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL can't be combined", ErrInvalidRRule)
+	}
+	if rule.Freq != FreqMonthly {
+		if len(rule.ByMonthDay) > 0 {
+			return nil, fmt.Errorf("%w: BYMONTHDAY needs FREQ=MONTHLY", ErrInvalidRRule)
+		}
+		for _, day := range rule.ByDay {
+			if day.N != 0 {
+				return nil, fmt.Errorf("%w: numbered BYDAY needs FREQ=MONTHLY", ErrInvalidRRule)
+			}
+		}
+	}
+
+	return rule, nil
+}
+
+func parseRRuleWeekday(v string) (RRuleWeekday, error) {
+	v = strings.ToUpper(v)
+	if len(v) < 2 {
+		return RRuleWeekday{}, fmt.Errorf("%w: invalid BYDAY %s", ErrInvalidRRule, v)
+	}
+
+	weekday, ok := rruleWeekdays[v[len(v)-2:]]
+	if !ok {
+		return RRuleWeekday{}, fmt.Errorf("%w: invalid BYDAY %s", ErrInvalidRRule, v)
+	}
+
+	n := 0
+	if prefix := v[:len(v)-2]; prefix != "" {
+		var err error
+		if n, err = strconv.Atoi(prefix); err != nil || n == 0 || n < -5 || n > 5 {
+			return RRuleWeekday{}, fmt.Errorf("%w: invalid BYDAY %s", ErrInvalidRRule, v)
+		}
+	}
+
+	return RRuleWeekday{N: n, Weekday: weekday}, nil
+}
+
+// parseRRuleUntil accepts the UTC date-time and date forms of UNTIL.
+func parseRRuleUntil(v string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102", v); err == nil {
+		// a date includes the whole day
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: UNTIL must look like 20240131 or 20240131T090000Z", ErrInvalidRRule)
+}
+
+// String formats the rule the way ParseRRule reads it.
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = strings.ToUpper(day.Weekday.String()[:2])
+			if day.N != 0 {
+				days[i] = strconv.Itoa(day.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences returns up to n occurrences of the series starting at dtstart
+// that come after after, along with their 1-based position in the series.
+// dtstart is always the first occurrence, even if the rule doesn't select it,
+// since it's the due date of the todo the series started with. Its location
+// decides what a day is and its clock time is kept by every occurrence.
+func (r *RRule) Occurrences(dtstart, after time.Time, n int) ([]time.Time, []int) {
+	var (
+		times     []time.Time
+		positions []int
+		position  = 1
+	)
+	if n < 1 {
+		return times, positions
+	}
+	if dtstart.After(after) {
+		times = append(times, dtstart)
+		positions = append(positions, position)
+	}
+
+	period := 0
+	if r.Count == 0 {
+		// without COUNT the periods before the one after falls in only add
+		// to the positions, which can be counted without walking them all
+		if p := r.periodOf(dtstart, after); p > 0 {
+			period = p
+			position = r.occurrencesBefore(dtstart, period)
+		}
+	}
+
+	for empty := 0; empty < maxRRuleEmptyPeriods && len(times) < n; period++ {
+		candidates := r.candidates(dtstart, period)
+		if len(candidates) == 0 {
+			empty++
+			continue
+		}
+		empty = 0
+
+		for _, t := range candidates {
+			if !t.After(dtstart) {
+				continue
+			}
+			if r.Until != nil && t.After(*r.Until) {
+				return times, positions
+			}
+			position++
+			if r.Count > 0 && position > r.Count {
+				return times, positions
+			}
+			if t.After(after) {
+				times = append(times, t)
+				positions = append(positions, position)
+				if len(times) == n {
+					break
+				}
+			}
+		}
+	}
+
+	return times, positions
+}
+
+// Next returns the first occurrence after after, ok is false when the series is over.
+func (r *RRule) Next(dtstart, after time.Time) (time.Time, int, bool) {
+	times, positions := r.Occurrences(dtstart, after, 1)
+	if len(times) == 0 {
+		return time.Time{}, 0, false
+	}
+	return times[0], positions[0], true
+}
+
+// candidates returns the sorted occurrences within the period-th period
+// (day, week or month, stepping by Interval) since dtstart.
+func (r *RRule) candidates(dtstart time.Time, period int) []time.Time {
+	loc := dtstart.Location()
+	hour, min, sec := dtstart.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hour, min, sec, 0, loc)
+	}
+
+	var days []time.Time
+	switch r.Freq {
+	case FreqDaily:
+		day := at(dtstart.Year(), dtstart.Month(), dtstart.Day()+period*r.Interval)
+		if r.matchesWeekday(day) {
+			days = append(days, day)
+		}
+	case FreqWeekly:
+		// Monday of dtstart's week
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		monday := at(dtstart.Year(), dtstart.Month(), dtstart.Day()-offset+period*r.Interval*7)
+		for i := 0; i < 7; i++ {
+			day := at(monday.Year(), monday.Month(), monday.Day()+i)
+			if len(r.ByDay) == 0 && day.Weekday() != dtstart.Weekday() {
+				continue
+			}
+			if r.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+	case FreqMonthly:
+		first := at(dtstart.Year(), dtstart.Month()+time.Month(period*r.Interval), 1)
+		days = r.monthCandidates(first, dtstart.Day())
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// periodOf returns the period since dtstart t falls in, negative if t comes
+// before dtstart's.
+func (r *RRule) periodOf(dtstart, t time.Time) int {
+	t = t.In(dtstart.Location())
+	date := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	days := int(date(t).Sub(date(dtstart)) / (24 * time.Hour))
+
+	var units int
+	switch r.Freq {
+	case FreqDaily:
+		units = days
+	case FreqWeekly:
+		// weeks between the Mondays of both weeks
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		units = floorDiv(days+offset, 7)
+	case FreqMonthly:
+		units = (t.Year()-dtstart.Year())*12 + int(t.Month()-dtstart.Month())
+	}
+	return floorDiv(units, r.Interval)
+}
+
+// occurrencesBefore returns the number of occurrences in the periods before
+// the period-th one, dtstart included.
+func (r *RRule) occurrencesBefore(dtstart time.Time, period int) int {
+	count := func(p int) int {
+		n := 0
+		for _, t := range r.candidates(dtstart, p) {
+			if t.After(dtstart) {
+				n++
+			}
+		}
+		return n
+	}
+
+	// from the first period on, every period has as many occurrences as the
+	// one cycle periods before it: days repeat their weekday every 7 days and
+	// weeks are all alike. Months are few enough to count one by one.
+	cycle := period
+	switch r.Freq {
+	case FreqDaily:
+		cycle = 7
+	case FreqWeekly:
+		cycle = 1
+	}
+
+	total := 1 + count(0)
+	for p := 1; p < period && p <= cycle; p++ {
+		// the periods q < period with q = p modulo cycle
+		total += count(p) * ((period-1-p)/cycle + 1)
+	}
+	return total
+}
+
+// floorDiv divides a by b rounding down, where / rounds towards zero.
+func floorDiv[T int | int64](a, b T) T {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func (r *RRule) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(r.ByDay, func(d RRuleWeekday) bool { return d.Weekday == day.Weekday() })
+}
+
+func (r *RRule) monthCandidates(first time.Time, defaultDay int) []time.Time {
+	daysIn := time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	// BYMONTHDAY limits BYDAY, without either the day of dtstart repeats
+	monthDays := r.ByMonthDay
+	if len(monthDays) == 0 && len(r.ByDay) == 0 {
+		monthDays = []int{defaultDay}
+	}
+
+	var days []time.Time
+	for d := 1; d <= daysIn; d++ {
+		day := first.AddDate(0, 0, d-1)
+		if len(monthDays) > 0 && !slices.ContainsFunc(monthDays, func(md int) bool {
+			return md == d || md == d-daysIn-1
+		}) {
+			continue
+		}
+		if len(r.ByDay) > 0 && !slices.ContainsFunc(r.ByDay, func(wd RRuleWeekday) bool {
+			return monthWeekdayMatches(wd, d, daysIn, day.Weekday())
+		}) {
+			continue
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// monthWeekdayMatches reports whether day d of a month with daysIn days, a
+// weekday, is selected by wd.
+func monthWeekdayMatches(wd RRuleWeekday, d, daysIn int, weekday time.Weekday) bool {
+	if wd.Weekday != weekday {
+		return false
+	}
+	switch {
+	case wd.N > 0:
+		return (d-1)/7+1 == wd.N
+	case wd.N < 0:
+		return (daysIn-d)/7+1 == -wd.N
+	}
+	return true
+}
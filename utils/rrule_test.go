@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustParseRRule(t *testing.T, s string) *RRule {
+	t.Helper()
+
+	rule, err := ParseRRule(s)
+	if err != nil {
+		t.Fatalf("ParseRRule(%q): %v", s, err)
+	}
+	return rule
+}
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // as formatted by String, empty if it's invalid
+	}{
+		{in: "FREQ=DAILY", want: "FREQ=DAILY"},
+		{in: "RRULE:freq=weekly;byday=mo,we;interval=2", want: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE"},
+		{in: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", want: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3"},
+		{in: "FREQ=MONTHLY;BYMONTHDAY=31,-1;UNTIL=20261231", want: "FREQ=MONTHLY;BYMONTHDAY=31,-1;UNTIL=20261231T235959Z"},
+		{in: "FREQ=DAILY;WKST=MO", want: "FREQ=DAILY"},
+		{in: ""},
+		{in: "INTERVAL=2"},
+		{in: "FREQ=YEARLY"},
+		{in: "FREQ=DAILY;FREQ=WEEKLY"},
+		{in: "FREQ=DAILY;INTERVAL=0"},
+		{in: "FREQ=DAILY;COUNT=-1"},
+		{in: "FREQ=DAILY;COUNT=2;UNTIL=20260101"},
+		{in: "FREQ=DAILY;UNTIL=2026-01-01"},
+		{in: "FREQ=WEEKLY;BYDAY=XX"},
+		{in: "FREQ=WEEKLY;BYDAY=1MO"},
+		{in: "FREQ=WEEKLY;BYMONTHDAY=1"},
+		{in: "FREQ=MONTHLY;BYMONTHDAY=32"},
+		{in: "FREQ=MONTHLY;BYDAY=6MO"},
+		{in: "FREQ=DAILY;WKST=SU"},
+		{in: "FREQ=DAILY;BYHOUR=9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			rule, err := ParseRRule(tt.in)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidRRule) {
+					t.Fatalf("ParseRRule = %v, %v, want ErrInvalidRRule", rule, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRRule: %v", err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("String() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRRuleOccurrences(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(y int, m time.Month, d, hour int) time.Time {
+		return time.Date(y, m, d, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		rule      string
+		dtstart   time.Time
+		after     time.Time
+		n         int
+		times     []time.Time
+		positions []int
+	}{
+		{
+			name:      "daily",
+			rule:      "FREQ=DAILY;INTERVAL=2",
+			dtstart:   date(2026, 1, 1, 9),
+			after:     date(2026, 1, 1, 9),
+			n:         3,
+			times:     []time.Time{date(2026, 1, 3, 9), date(2026, 1, 5, 9), date(2026, 1, 7, 9)},
+			positions: []int{2, 3, 4},
+		},
+		{
+			name:      "dtstart is the first occurrence",
+			rule:      "FREQ=WEEKLY;BYDAY=MO",
+			dtstart:   date(2026, 1, 7, 9), // a Wednesday
+			after:     date(2026, 1, 1, 0),
+			n:         3,
+			times:     []time.Time{date(2026, 1, 7, 9), date(2026, 1, 12, 9), date(2026, 1, 19, 9)},
+			positions: []int{1, 2, 3},
+		},
+		{
+			name:    "weekly by day",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+			dtstart: date(2026, 1, 7, 9),
+			after:   date(2026, 1, 7, 9),
+			n:       4,
+			times: []time.Time{
+				date(2026, 1, 9, 9), date(2026, 1, 12, 9), date(2026, 1, 14, 9), date(2026, 1, 16, 9),
+			},
+			positions: []int{2, 3, 4, 5},
+		},
+		{
+			name:      "weekly keeps dtstart's weekday",
+			rule:      "FREQ=WEEKLY;INTERVAL=2",
+			dtstart:   date(2026, 1, 7, 9),
+			after:     date(2026, 1, 7, 9),
+			n:         2,
+			times:     []time.Time{date(2026, 1, 21, 9), date(2026, 2, 4, 9)},
+			positions: []int{2, 3},
+		},
+		{
+			name:      "daily by day",
+			rule:      "FREQ=DAILY;BYDAY=SA,SU",
+			dtstart:   date(2026, 1, 5, 9), // a Monday
+			after:     date(2026, 1, 5, 9),
+			n:         3,
+			times:     []time.Time{date(2026, 1, 10, 9), date(2026, 1, 11, 9), date(2026, 1, 17, 9)},
+			positions: []int{2, 3, 4},
+		},
+		{
+			name:    "the 31st skips short months",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=31",
+			dtstart: date(2026, 1, 31, 9),
+			after:   date(2026, 1, 31, 9),
+			n:       5,
+			times: []time.Time{
+				date(2026, 3, 31, 9), date(2026, 5, 31, 9), date(2026, 7, 31, 9), date(2026, 8, 31, 9), date(2026, 10, 31, 9),
+			},
+			positions: []int{2, 3, 4, 5, 6},
+		},
+		{
+			name:      "the last day of the month",
+			rule:      "FREQ=MONTHLY;BYMONTHDAY=-1",
+			dtstart:   date(2026, 1, 31, 9),
+			after:     date(2026, 1, 31, 9),
+			n:         3,
+			times:     []time.Time{date(2026, 2, 28, 9), date(2026, 3, 31, 9), date(2026, 4, 30, 9)},
+			positions: []int{2, 3, 4},
+		},
+		{
+			name:      "the second Tuesday",
+			rule:      "FREQ=MONTHLY;BYDAY=2TU",
+			dtstart:   date(2026, 1, 13, 9),
+			after:     date(2026, 1, 13, 9),
+			n:         3,
+			times:     []time.Time{date(2026, 2, 10, 9), date(2026, 3, 10, 9), date(2026, 4, 14, 9)},
+			positions: []int{2, 3, 4},
+		},
+		{
+			name:      "the last Friday",
+			rule:      "FREQ=MONTHLY;BYDAY=-1FR",
+			dtstart:   date(2026, 1, 30, 9),
+			after:     date(2026, 1, 30, 9),
+			n:         2,
+			times:     []time.Time{date(2026, 2, 27, 9), date(2026, 3, 27, 9)},
+			positions: []int{2, 3},
+		},
+		{
+			name:      "count",
+			rule:      "FREQ=DAILY;COUNT=3",
+			dtstart:   date(2026, 1, 1, 9),
+			after:     date(2025, 12, 31, 0),
+			n:         5,
+			times:     []time.Time{date(2026, 1, 1, 9), date(2026, 1, 2, 9), date(2026, 1, 3, 9)},
+			positions: []int{1, 2, 3},
+		},
+		{
+			name:    "count is over",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: date(2026, 1, 1, 9),
+			after:   date(2026, 1, 3, 9),
+			n:       5,
+		},
+		{
+			name:      "until includes its day",
+			rule:      "FREQ=DAILY;UNTIL=20260103",
+			dtstart:   date(2026, 1, 1, 9),
+			after:     date(2026, 1, 1, 9),
+			n:         5,
+			times:     []time.Time{date(2026, 1, 2, 9), date(2026, 1, 3, 9)},
+			positions: []int{2, 3},
+		},
+		{
+			name:      "until is an instant",
+			rule:      "FREQ=DAILY;UNTIL=20260103T085959Z",
+			dtstart:   date(2026, 1, 1, 9),
+			after:     date(2026, 1, 1, 9),
+			n:         5,
+			times:     []time.Time{date(2026, 1, 2, 9)},
+			positions: []int{2},
+		},
+		{
+			name:    "clock time is kept across the start of DST",
+			rule:    "FREQ=DAILY",
+			dtstart: time.Date(2026, 3, 7, 9, 0, 0, 0, newYork),
+			after:   time.Date(2026, 3, 7, 9, 0, 0, 0, newYork),
+			n:       2,
+			// 09:00 EST, then 09:00 EDT
+			times:     []time.Time{date(2026, 3, 8, 13), date(2026, 3, 9, 13)},
+			positions: []int{2, 3},
+		},
+		{
+			name:      "clock time is kept across the end of DST",
+			rule:      "FREQ=WEEKLY",
+			dtstart:   time.Date(2026, 10, 26, 9, 0, 0, 0, newYork),
+			after:     time.Date(2026, 10, 26, 9, 0, 0, 0, newYork),
+			n:         2,
+			times:     []time.Time{date(2026, 11, 2, 14), date(2026, 11, 9, 14)},
+			positions: []int{2, 3},
+		},
+		{
+			name:      "days follow dtstart's time zone",
+			rule:      "FREQ=WEEKLY;BYDAY=MO",
+			dtstart:   time.Date(2026, 1, 5, 21, 0, 0, 0, newYork), // Tuesday in UTC
+			after:     time.Date(2026, 1, 5, 21, 0, 0, 0, newYork),
+			n:         1,
+			times:     []time.Time{date(2026, 1, 13, 2)},
+			positions: []int{2},
+		},
+		{
+			name:      "long running daily series",
+			rule:      "FREQ=DAILY",
+			dtstart:   date(1990, 1, 1, 9),
+			after:     date(2026, 1, 1, 0),
+			n:         2,
+			times:     []time.Time{date(2026, 1, 1, 9), date(2026, 1, 2, 9)},
+			positions: []int{13150, 13151},
+		},
+		{
+			name:      "long running weekly series",
+			rule:      "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			dtstart:   date(1990, 1, 5, 9), // a Friday
+			after:     date(2026, 1, 1, 0),
+			n:         2,
+			times:     []time.Time{date(2026, 1, 2, 9), date(2026, 1, 12, 9)},
+			positions: []int{1879, 1880},
+		},
+		{
+			name:      "long running monthly series",
+			rule:      "FREQ=MONTHLY;BYMONTHDAY=31",
+			dtstart:   date(1990, 1, 31, 9),
+			after:     date(2026, 1, 1, 0),
+			n:         2,
+			times:     []time.Time{date(2026, 1, 31, 9), date(2026, 3, 31, 9)},
+			positions: []int{253, 254},
+		},
+		{
+			name:    "no further occurrence",
+			rule:    "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=31",
+			dtstart: date(2026, 4, 30, 9),
+			after:   date(2026, 4, 30, 9),
+			n:       1,
+		},
+		{
+			name:    "long running series with a count",
+			rule:    "FREQ=DAILY;COUNT=10",
+			dtstart: date(1990, 1, 1, 9),
+			after:   date(2026, 1, 1, 0),
+			n:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times, positions := mustParseRRule(t, tt.rule).Occurrences(tt.dtstart, tt.after, tt.n)
+			if len(times) != len(tt.times) {
+				t.Fatalf("Occurrences = %v, want %v", times, tt.times)
+			}
+			for i := range times {
+				if !times[i].Equal(tt.times[i]) {
+					t.Errorf("occurrence %d = %v, want %v", i, times[i].UTC(), tt.times[i])
+				}
+			}
+			if len(positions) > 0 && !reflect.DeepEqual(positions, tt.positions) {
+				t.Errorf("positions = %v, want %v", positions, tt.positions)
+			}
+		})
+	}
+}
+
+// skipping to the period after falls in has to find the same occurrences,
+// at the same positions, as walking the series from its start.
+func TestRRuleNextSkipsAhead(t *testing.T) {
+	rules := []string{
+		"FREQ=DAILY",
+		"FREQ=DAILY;INTERVAL=3;BYDAY=MO,TU",
+		"FREQ=WEEKLY;BYDAY=TU,SU",
+		"FREQ=WEEKLY;INTERVAL=3",
+		"FREQ=MONTHLY;BYMONTHDAY=30,-1",
+		"FREQ=MONTHLY;INTERVAL=5;BYDAY=1MO,-2FR",
+		"FREQ=DAILY;UNTIL=20270101",
+	}
+	dtstart := time.Date(2025, 12, 31, 18, 30, 0, 0, time.UTC)
+
+	for _, s := range rules {
+		t.Run(s, func(t *testing.T) {
+			rule := mustParseRRule(t, s)
+			times, positions := rule.Occurrences(dtstart, dtstart.Add(-time.Second), 200)
+
+			for i := 0; i+1 < len(times); i++ {
+				next, position, ok := rule.Next(dtstart, times[i])
+				if !ok || !next.Equal(times[i+1]) || position != positions[i+1] {
+					t.Fatalf("Next(%v) = %v, %d, %v, want %v, %d", times[i], next, position, ok, times[i+1], positions[i+1])
+				}
+				// and from anywhere in between
+				next, position, _ = rule.Next(dtstart, times[i].Add(time.Minute))
+				if !next.Equal(times[i+1]) || position != positions[i+1] {
+					t.Fatalf("Next(%v) = %v, %d, want %v, %d", times[i].Add(time.Minute), next, position, times[i+1], positions[i+1])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Scopes a personal access token can be granted. Sessions (JWTs) implicitly
+// hold every scope.
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+)
+
+const personalAccessTokenPrefix = "tdp_"
+
+// GeneratePersonalAccessToken works like GenerateOpaqueToken, but the token is
+// prefixed so WithJWT (and secret scanners) can tell it apart from a JWT.
+func GeneratePersonalAccessToken() (token, hash string, err error) {
+	token, _, err = GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = personalAccessTokenPrefix + token
+	return token, HashOpaqueToken(token), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+// Retrieve the scopes of the personal access token from request context.
+// ok is false for requests authenticated with a session.
+func GetScopesFromContext(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(scopesKey).([]string)
+	return scopes, ok
+}
+
+// RequireScope rejects requests made with a personal access token that
+// wasn't granted scope. Write scopes are also denied to users who still
+// have to verify their email address.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if scopes, ok := GetScopesFromContext(r.Context()); ok && !slices.Contains(scopes, scope) {
+			WriteJSON(w, http.StatusForbidden, NewApiError(http.StatusForbidden, fmt.Sprintf("token is missing the '%s' scope", scope)))
+			return
+		}
+		if readOnly, _ := r.Context().Value(readOnlyKey).(bool); readOnly && strings.HasSuffix(scope, ":write") {
+			WriteJSON(w, http.StatusForbidden, NewApiError(http.StatusForbidden, "verify your email address first"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RequireSession rejects requests made with a personal access token, for
+// routes that manage the account itself.
+func RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetScopesFromContext(r.Context()); ok {
+			WriteJSON(w, http.StatusForbidden, NewApiError(http.StatusForbidden, "personal access tokens can't be used here"))
+			return
+		}
+		next(w, r)
+	}
+}
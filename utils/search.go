@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+// searchStopwords are the stop words of Postgres' english text search
+// configuration, the one todos are indexed with. It drops them from queries,
+// so a term made of them alone would leave nothing to search for.
+var searchStopwords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+		i me my myself we our ours ourselves you your yours yourself yourselves
+		he him his himself she her hers herself it its itself they them their
+		theirs themselves what which who whom this that these those am is are
+		was were be been being have has had having do does did doing a an the
+		and but if or because as until while of at by for with about against
+		between into through during before after above below to from up down
+		in out on off over under again further then once here there when where
+		why how all any both each few more most other some such no nor not only
+		own same so than too very s t can will just don should now`) {
+		searchStopwords[word] = true
+	}
+}
+
+// ParseSearchQuery turns a search like
+//
+//	"weekly report" draft* -old OR new
+//
+// into the text of a Postgres tsquery: terms are ANDed, quoted terms are
+// phrases, a trailing * makes a prefix match, a leading - excludes a term and
+// OR matches either of the terms around it. Terms are reduced to letters and
+// digits, so the result never contains tsquery syntax from the input, and
+// terms made only of stop words are left out. It fails if no term is left.
+func ParseSearchQuery(s string) (string, error) {
+	var (
+		groups [][]string // ANDed groups of ORed terms
+		or     bool
+	)
+	for _, token := range splitSearchQuery(s) {
+		if token == "OR" {
+			or = len(groups) > 0
+			continue
+		}
+
+		negate := strings.HasPrefix(token, "-") && len(token) > 1
+		if negate {
+			token = token[1:]
+		}
+
+		term := searchTerm(token)
+		if term == "" {
+			// "a OR the b" searches for a and b
+			or = false
+			continue
+		}
+		if negate {
+			term = "!" + term
+		}
+
+		if or {
+			groups[len(groups)-1] = append(groups[len(groups)-1], term)
+		} else {
+			groups = append(groups, []string{term})
+		}
+		or = false
+	}
+
+	if len(groups) == 0 {
+		return "", ErrInvalidSearchQuery
+	}
+
+	parts := make([]string, len(groups))
+	for i, group := range groups {
+		parts[i] = strings.Join(group, " | ")
+		if len(group) > 1 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " & "), nil
+}
+
+// splitSearchQuery splits s at spaces outside of double quotes. Quoted
+// tokens keep their quotes, an unclosed quote runs to the end.
+func splitSearchQuery(s string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		quoted  bool
+	)
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			if quoted {
+				current.WriteRune(r)
+				flush()
+			} else {
+				// -"a phrase" excludes the phrase
+				if current.String() != "-" {
+					flush()
+				}
+				current.WriteRune(r)
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// searchTerm turns a token into a tsquery term. The words of phrases, and of
+// tokens like "e-mail", have to follow each other. It returns "" if the token
+// has no words other than stop words.
+func searchTerm(token string) string {
+	token = strings.Trim(token, `"`)
+
+	var words []string
+	for _, field := range strings.Fields(token) {
+		prefix := strings.HasSuffix(field, "*")
+		parts := strings.FieldsFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(parts) == 0 {
+			continue
+		}
+		if prefix {
+			parts[len(parts)-1] += ":*"
+		}
+		for i := range parts {
+			parts[i] = strings.ToLower(parts[i])
+		}
+		words = append(words, parts...)
+	}
+
+	if !slices.ContainsFunc(words, func(w string) bool { return !searchStopwords[strings.TrimSuffix(w, ":*")] }) {
+		return ""
+	}
+
+	switch len(words) {
+	case 1:
+		return words[0]
+	}
+	return "(" + strings.Join(words, " <-> ") + ")"
+}
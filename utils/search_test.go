@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // empty if it's invalid
+	}{
+		{in: "report", want: "report"},
+		{in: "REPORT", want: "report"},
+		{in: "Café", want: "café"},
+		{in: "weekly report", want: "weekly & report"},
+		{in: "  weekly   report  ", want: "weekly & report"},
+		{in: `"weekly report"`, want: "(weekly <-> report)"},
+		{in: `"weekly report`, want: "(weekly <-> report)"},
+		{in: "draft*", want: "draft:*"},
+		{in: `"weekly rep*"`, want: "(weekly <-> rep:*)"},
+		{in: "-old", want: "!old"},
+		{in: `-"weekly report"`, want: "!(weekly <-> report)"},
+		{in: "old OR new", want: "(old | new)"},
+		{in: "old OR new OR draft", want: "(old | new | draft)"},
+		{in: "old or new", want: "old & new"},
+		{in: "OR report", want: "report"},
+		{in: "report OR", want: "report"},
+		{in: "e-mail", want: "(e <-> mail)"},
+		{in: `"weekly report" draft* -old OR new`, want: "(weekly <-> report) & draft:* & (!old | new)"},
+
+		// tsquery syntax in the input is only ever a separator
+		{in: "x & y | !z:* <-> (w)", want: "x & y & z:* & w"},
+		{in: `report'); DROP TABLE todos; --`, want: "report & drop & table & todos"},
+		{in: `x:A`, want: "(x <-> a)"},
+
+		// stop words
+		{in: "the report", want: "report"},
+		{in: `"the report"`, want: "(the <-> report)"},
+		{in: "the OR report", want: "report"},
+		{in: "report OR the draft", want: "report & draft"},
+		{in: "report OR the OR draft", want: "(report | draft)"},
+		{in: "-the report", want: "report"},
+		{in: "the*", want: ""},
+		{in: "the", want: ""},
+		{in: "THE", want: ""},
+		{in: "-the", want: ""},
+		{in: "don't", want: ""},
+		{in: `"to be or not to be"`, want: ""},
+		{in: "the OR a", want: ""},
+
+		{in: "", want: ""},
+		{in: "   ", want: ""},
+		{in: "OR", want: ""},
+		{in: "!!! --- **", want: ""},
+		{in: `""`, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSearchQuery(tt.in)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidSearchQuery) {
+					t.Fatalf("ParseSearchQuery = %q, %v, want ErrInvalidSearchQuery", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSearchQuery: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSearchQuery = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA-1 secret of RFC 4226 and RFC 6238, "12345678901234567890"
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226, appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	key := []byte("12345678901234567890")
+	for counter, code := range want {
+		if got := hotp(key, int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238, appendix B, SHA-1. The codes there have 8 digits, these are
+	// their last 6.
+	tests := []struct {
+		unix int64
+		step int64
+		code string
+	}{
+		{unix: 59, step: 0x1, code: "287082"},
+		{unix: 1111111109, step: 0x23523EC, code: "081804"},
+		{unix: 1111111111, step: 0x23523ED, code: "050471"},
+		{unix: 1234567890, step: 0x273EF07, code: "005924"},
+		{unix: 2000000000, step: 0x3F940AA, code: "279037"},
+		{unix: 20000000000, step: 0x27BC86AA, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfcTOTPSecret, tt.code, time.Unix(tt.unix, 0))
+			if !ok || step != tt.step {
+				t.Fatalf("ValidateTOTP at %d = %d, %v, want %d, true", tt.unix, step, ok, tt.step)
+			}
+
+			// a period of clock drift either way is accepted, two aren't
+			first := (tt.step - totpSkew) * totpPeriod
+			last := (tt.step+totpSkew+1)*totpPeriod - 1
+			for _, at := range []int64{first, last} {
+				if step, ok := ValidateTOTP(rfcTOTPSecret, tt.code, time.Unix(at, 0)); !ok || step != tt.step {
+					t.Errorf("ValidateTOTP at %d = %d, %v, want %d, true", at, step, ok, tt.step)
+				}
+			}
+			for _, at := range []int64{first - 1, last + 1} {
+				if step, ok := ValidateTOTP(rfcTOTPSecret, tt.code, time.Unix(at, 0)); ok {
+					t.Errorf("ValidateTOTP at %d = %d, true, want false", at, step)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	at := time.Unix(59, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+	}{
+		{name: "lowercase secret", secret: strings.ToLower(rfcTOTPSecret), code: "287082", ok: true},
+		{name: "wrong code", secret: rfcTOTPSecret, code: "287083"},
+		{name: "8 digit code", secret: rfcTOTPSecret, code: "94287082"},
+		{name: "short code", secret: rfcTOTPSecret, code: "28708"},
+		{name: "empty code", secret: rfcTOTPSecret, code: ""},
+		{name: "padded code", secret: rfcTOTPSecret, code: " 287082"},
+		{name: "secret isn't base32", secret: "not base32!", code: "287082"},
+		{name: "empty secret", secret: "", code: "328482"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, at); ok != tt.ok {
+				t.Errorf("ValidateTOTP = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("GenerateTOTPSecret = %q, want 20 base32-encoded bytes", secret)
+	}
+
+	// it works with the code an authenticator app computes from it
+	now := time.Now()
+	code := hotp(key, now.Unix()/totpPeriod)
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Errorf("ValidateTOTP(%q, %q) = false, want true", secret, code)
+	}
+}